@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -11,6 +13,24 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	DBPort     string
+
+	// Port of the gRPC chat API
+	GRPCPort string
+
+	// Usernames promoted to server administrators at startup while there
+	// is no administrator yet
+	AdminUsernames []string
+
+	// Attachment storage
+	StorageDriver  string // local or s3
+	StoragePath    string // Root directory for the local driver
+	S3Endpoint     string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3Bucket       string
+	S3UseSSL       bool
+	MaxUploadBytes int64 // Largest accepted attachment
+	UserQuotaBytes int64 // Total attachment bytes a user may store
 }
 
 func NewConfig() *Config {
@@ -20,6 +40,25 @@ func NewConfig() *Config {
 		DBPassword: getEnvOrDefault("DB_PASSWORD", "123321"),
 		DBName:     getEnvOrDefault("DB_NAME", "chat_app"),
 		DBPort:     getEnvOrDefault("DB_PORT", "5432"),
+
+		GRPCPort: getEnvOrDefault("GRPC_PORT", "9090"),
+
+		StorageDriver:  getEnvOrDefault("STORAGE_DRIVER", "local"),
+		StoragePath:    getEnvOrDefault("STORAGE_PATH", "./data/attachments"),
+		S3Endpoint:     os.Getenv("S3_ENDPOINT"),
+		S3AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:    os.Getenv("S3_SECRET_KEY"),
+		S3Bucket:       os.Getenv("S3_BUCKET"),
+		S3UseSSL:       os.Getenv("S3_USE_SSL") == "true",
+		MaxUploadBytes: getEnvInt64OrDefault("MAX_UPLOAD_BYTES", 25<<20),
+		UserQuotaBytes: getEnvInt64OrDefault("USER_QUOTA_BYTES", 1<<30),
+	}
+	if admins := os.Getenv("ADMIN_USERNAMES"); admins != "" {
+		for _, name := range strings.Split(admins, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.AdminUsernames = append(config.AdminUsernames, name)
+			}
+		}
 	}
 
 	// Validate critical fields
@@ -38,3 +77,17 @@ func getEnvOrDefault(key, defaultValue string) string {
 	log.Printf("Environment variable %s not set, using default: %s", key, defaultValue)
 	return defaultValue
 }
+
+// Helper function to get a numeric env var or fallback to default
+func getEnvInt64OrDefault(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Environment variable %s not set, using default: %d", key, defaultValue)
+		return defaultValue
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Environment variable %s must be an integer: %v", key, err)
+	}
+	return n
+}
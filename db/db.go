@@ -11,6 +11,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// Models are the tables kept up to date by AutoMigrate.
+var Models = []interface{}{&entity.User{}, &entity.Message{}, &entity.Group{}, &entity.GroupMember{}, &entity.BlockedUser{}, &entity.GroupInvite{}, &entity.GroupJoinRequest{}, &entity.GroupBan{}, &entity.GroupAuditLog{}, &entity.MessageReaction{}, &entity.AdminAuditLog{}, &entity.Attachment{}, &entity.Mention{}, &entity.PinnedMessage{}, &entity.StarredMessage{}, &entity.Conversation{}, &entity.ConversationParticipant{}, &entity.Webhook{}, &entity.WebhookDelivery{}, &entity.IncomingWebhook{}, &entity.Bot{}, &entity.SlashCommand{}, &entity.CommandInvocation{}, &entity.MessageInteraction{}}
+
 func NewDB(config *config.Config) *gorm.DB {
 	// Construct the DSN
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
@@ -26,13 +29,163 @@ func NewDB(config *config.Config) *gorm.DB {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Cached member counts start from the memberships stored before the
+	// column existed; afterwards GroupMember hooks keep them in sync
+	countMembers := !db.Migrator().HasColumn(&entity.Group{}, "member_count")
+
 	// Run migrations
-	if err := db.AutoMigrate(&entity.User{}, &entity.Message{}, &entity.Group{}, &entity.GroupMember{}, &entity.BlockedUser{}); err != nil {
+	if err := db.AutoMigrate(Models...); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Full-text search index for message search
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_content_fts ON messages USING GIN (to_tsvector('english', content))`).Error; err != nil {
+		log.Fatalf("Failed to create message search index: %v", err)
+	}
+
+	// Client message IDs are unique per sender; messages without one are exempt
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_msg_id ON messages (sender_id, client_msg_id) WHERE client_msg_id <> ''`).Error; err != nil {
+		log.Fatalf("Failed to create client message ID index: %v", err)
+	}
+
+	if err := backfillSequences(db); err != nil {
+		log.Fatalf("Failed to backfill message sequence numbers: %v", err)
+	}
+	if err := backfillConversations(db); err != nil {
+		log.Fatalf("Failed to backfill conversations: %v", err)
+	}
+	// Sequence numbers are unique within a conversation
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_conversation_seq ON messages (conversation_id, seq) WHERE seq > 0`).Error; err != nil {
+		log.Fatalf("Failed to create message sequence index: %v", err)
+	}
+
+	if countMembers {
+		if err := db.Exec(`UPDATE groups SET member_count = (
+			SELECT COUNT(*) FROM group_members
+			WHERE group_members.group_id = groups.id AND group_members.deleted_at IS NULL)`).Error; err != nil {
+			log.Fatalf("Failed to count group members: %v", err)
+		}
+	}
+
+	// The admin audit log is append-only; reject edits at the database level
+	for _, stmt := range []string{
+		`CREATE OR REPLACE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'admin_audit_logs is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS admin_audit_logs_append_only ON admin_audit_logs`,
+		`CREATE TRIGGER admin_audit_logs_append_only BEFORE UPDATE OR DELETE ON admin_audit_logs
+		FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change()`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Fatalf("Failed to protect the admin audit log: %v", err)
+		}
+	}
+
+	if len(config.AdminUsernames) > 0 {
+		if err := seedAdmins(db, config.AdminUsernames); err != nil {
+			log.Fatalf("Failed to promote administrators: %v", err)
+		}
+	}
+
 	log.Println("Database connection established and migrations completed")
 	return db
 }
 
+// seedAdmins promotes the given users to administrators while the server
+// has none, to bootstrap a fresh install. Once an administrator exists,
+// roles are only changed through the admin API, so a restart never promotes
+// someone who registered a listed username later. Bots and disabled
+// accounts are never promoted.
+func seedAdmins(db *gorm.DB, usernames []string) error {
+	var admins int64
+	if err := db.Model(&entity.User{}).Where("role = ?", entity.UserRoleAdmin).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+	result := db.Model(&entity.User{}).
+		Where("username IN ? AND role = ? AND disabled_at IS NULL", usernames, entity.UserRoleUser).
+		Update("role", entity.UserRoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Promoted %d of %d ADMIN_USERNAMES to administrators", result.RowsAffected, len(usernames))
+	return nil
+}
+
+// backfillSequences numbers the messages stored before sequence numbers
+// existed, in creation order per group or direct pair. It only runs while no
+// message has a sequence number yet. Scheduled messages that are still
+// pending are numbered when sent.
+func backfillSequences(db *gorm.DB) error {
+	var numbered bool
+	if err := db.Raw(`SELECT EXISTS (SELECT 1 FROM messages WHERE seq > 0)`).Scan(&numbered).Error; err != nil {
+		return err
+	}
+	if numbered {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			`UPDATE messages SET seq = numbered.seq FROM (
+				SELECT id, ROW_NUMBER() OVER (
+					PARTITION BY group_id,
+						CASE WHEN group_id = 0 THEN LEAST(sender_id, receiver_id) END,
+						CASE WHEN group_id = 0 THEN GREATEST(sender_id, receiver_id) END
+					ORDER BY id) AS seq
+				FROM messages
+				WHERE (group_id <> 0 OR receiver_id <> 0) AND (sent OR scheduled_time IS NULL)
+			) AS numbered WHERE messages.id = numbered.id`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backfillConversations creates conversations for existing groups and
+// direct pairs, files their messages under them and initializes the
+// sequence counters. Every step skips rows that are already done, so it is
+// cheap on later starts.
+func backfillConversations(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			`INSERT INTO conversations (type, group_id, low_user_id, high_user_id, message_ttl, last_seq, created_at, updated_at)
+			SELECT 'group', id, 0, 0, 0, 0, created_at, NOW() FROM groups
+			ON CONFLICT (group_id, low_user_id, high_user_id) DO NOTHING`,
+			`INSERT INTO conversations (type, group_id, low_user_id, high_user_id, message_ttl, last_seq, created_at, updated_at)
+			SELECT 'direct', 0, LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id), 0, 0, MIN(created_at), NOW()
+			FROM messages WHERE group_id = 0 AND receiver_id <> 0
+			GROUP BY LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id)
+			ON CONFLICT (group_id, low_user_id, high_user_id) DO NOTHING`,
+			`INSERT INTO conversation_participants (conversation_id, user_id, created_at)
+			SELECT id, low_user_id, created_at FROM conversations WHERE type = 'direct'
+			UNION ALL
+			SELECT id, high_user_id, created_at FROM conversations WHERE type = 'direct'
+			ON CONFLICT (conversation_id, user_id) DO NOTHING`,
+			`UPDATE messages SET conversation_id = conversations.id FROM conversations
+			WHERE (messages.conversation_id IS NULL OR messages.conversation_id = 0)
+				AND messages.group_id <> 0 AND conversations.group_id = messages.group_id`,
+			`UPDATE messages SET conversation_id = conversations.id FROM conversations
+			WHERE (messages.conversation_id IS NULL OR messages.conversation_id = 0)
+				AND messages.group_id = 0 AND messages.receiver_id <> 0 AND conversations.group_id = 0
+				AND conversations.low_user_id = LEAST(messages.sender_id, messages.receiver_id)
+				AND conversations.high_user_id = GREATEST(messages.sender_id, messages.receiver_id)`,
+			`UPDATE conversations SET last_seq = GREATEST(last_seq,
+				COALESCE((SELECT MAX(seq) FROM messages WHERE messages.conversation_id = conversations.id), 0))`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 var Module = fx.Provide(NewDB)
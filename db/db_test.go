@@ -0,0 +1,57 @@
+package db
+
+import (
+	"chat_app/entity"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSeedAdmins(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "chat.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(&entity.User{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, user := range []entity.User{
+		{Username: "alice", Role: entity.UserRoleUser},
+		{Username: "bot", Role: entity.UserRoleBot},
+		{Username: "gone", Role: entity.UserRoleUser, DisabledAt: &now},
+	} {
+		database.Create(&user)
+	}
+	roles := func() map[string]string {
+		var users []entity.User
+		database.Find(&users)
+		byName := make(map[string]string)
+		for _, user := range users {
+			byName[user.Username] = user.Role
+		}
+		return byName
+	}
+	listed := []string{"alice", "bot", "gone", "mallory"}
+
+	if err := seedAdmins(database, listed); err != nil {
+		t.Fatal(err)
+	}
+	got := roles()
+	if got["alice"] != entity.UserRoleAdmin || got["bot"] != entity.UserRoleBot || got["gone"] != entity.UserRoleUser {
+		t.Fatalf("after bootstrapping: %v", got)
+	}
+
+	// A listed username registered after an admin exists stays a user
+	database.Create(&entity.User{Username: "mallory", Role: entity.UserRoleUser})
+	if err := seedAdmins(database, listed); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); got["mallory"] != entity.UserRoleUser {
+		t.Fatalf("a later registration was promoted: %v", got)
+	}
+}
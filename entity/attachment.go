@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type Attachment struct {
+	gorm.Model
+	UploaderID   uint   `json:"uploader_id" gorm:"index"`
+	MessageID    uint   `json:"message_id" gorm:"index"` // 0 until sent with a message
+	StorageKey   string `json:"-"`
+	FileName     string `json:"file_name"`
+	ContentType  string `json:"content_type"` // Sniffed from the content, not taken from the client
+	Size         int64  `json:"size"`
+	Width        int    `json:"width,omitempty"`    // Images only, as displayed
+	Height       int    `json:"height,omitempty"`   // Images only, as displayed
+	Blurhash     string `json:"blurhash,omitempty"` // Placeholder shown until the image loads
+	ThumbnailKey string `json:"-"`
+	PreviewKey   string `json:"-"`
+
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"-"`
+	PreviewURL   string `json:"preview_url,omitempty" gorm:"-"`
+}
+
+// AfterFind fills in the download URLs of the rendered images.
+func (a *Attachment) AfterFind(tx *gorm.DB) error {
+	a.SetURLs()
+	return nil
+}
+
+// SetURLs fills in the download URLs of the rendered images, if any.
+func (a *Attachment) SetURLs() {
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = fmt.Sprintf("/attachments/%d/thumbnail", a.ID)
+	}
+	if a.PreviewKey != "" {
+		a.PreviewURL = fmt.Sprintf("/attachments/%d/preview", a.ID)
+	}
+}
@@ -0,0 +1,184 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Block types.
+const (
+	BlockSection = "section" // Text
+	BlockActions = "actions" // Buttons and select menus, each sent on its own
+	BlockForm    = "form"    // Inputs and selects, sent together by a submit button
+)
+
+// Element types.
+const (
+	ElementButton    = "button"
+	ElementSelect    = "select"
+	ElementTextInput = "text_input" // Forms only
+)
+
+const (
+	maxBlocks   = 20
+	maxElements = 25 // Per block
+	maxOptions  = 100
+)
+
+// Blocks is the structured content of an interactive message, stored as
+// JSON next to the plain-text Content, which clients show as a fallback.
+type Blocks []Block
+
+type Block struct {
+	Type        string    `json:"type"`
+	BlockID     string    `json:"block_id,omitempty"` // Required for forms; submitted as the action_id
+	Text        string    `json:"text,omitempty"`     // Sections
+	Elements    []Element `json:"elements,omitempty"` // Actions and forms
+	SubmitLabel string    `json:"submit_label,omitempty"`
+}
+
+type Element struct {
+	Type        string   `json:"type"`
+	ActionID    string   `json:"action_id"`
+	Label       string   `json:"label,omitempty"`
+	Value       string   `json:"value,omitempty"` // Buttons
+	Style       string   `json:"style,omitempty"` // Buttons: primary or danger
+	Options     []Option `json:"options,omitempty"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Required    bool     `json:"required,omitempty"` // Form fields
+	Multiline   bool     `json:"multiline,omitempty"`
+}
+
+type Option struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+func (b Blocks) Value() (driver.Value, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(b)
+	return string(data), err
+}
+
+func (b *Blocks) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*b = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, b)
+	case string:
+		return json.Unmarshal([]byte(v), b)
+	}
+	return fmt.Errorf("cannot scan %T into Blocks", value)
+}
+
+// Validate checks the structure of blocks sent by a bot. Action IDs must be
+// unique within a message, since interactions name them.
+func (b Blocks) Validate() error {
+	if len(b) > maxBlocks {
+		return fmt.Errorf("A message can have at most %d blocks", maxBlocks)
+	}
+	actionIDs := make(map[string]bool)
+	claim := func(id string) error {
+		if id == "" {
+			return errors.New("Every element needs an action_id")
+		}
+		if actionIDs[id] {
+			return fmt.Errorf("Duplicate action_id %q", id)
+		}
+		actionIDs[id] = true
+		return nil
+	}
+
+	for _, block := range b {
+		switch block.Type {
+		case BlockSection:
+			if block.Text == "" || len(block.Elements) > 0 {
+				return errors.New("Section blocks need text and no elements")
+			}
+			continue
+		case BlockActions:
+		case BlockForm:
+			if err := claim(block.BlockID); err != nil {
+				return fmt.Errorf("Form blocks need a unique block_id")
+			}
+		default:
+			return fmt.Errorf("Unknown block type %q", block.Type)
+		}
+		if len(block.Elements) == 0 || len(block.Elements) > maxElements {
+			return fmt.Errorf("Blocks need 1 to %d elements", maxElements)
+		}
+		for _, element := range block.Elements {
+			if err := claim(element.ActionID); err != nil {
+				return err
+			}
+			switch element.Type {
+			case ElementButton:
+				if block.Type == BlockForm {
+					return errors.New("Forms have a single submit button; use submit_label")
+				}
+				if element.Label == "" {
+					return errors.New("Buttons need a label")
+				}
+			case ElementSelect:
+				if len(element.Options) == 0 || len(element.Options) > maxOptions {
+					return fmt.Errorf("Select menus need 1 to %d options", maxOptions)
+				}
+			case ElementTextInput:
+				if block.Type != BlockForm {
+					return errors.New("Text inputs are only allowed in forms")
+				}
+			default:
+				return fmt.Errorf("Unknown element type %q", element.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// Find returns the block and element an action ID names. For a form the
+// action ID is its block_id and the element is nil.
+func (b Blocks) Find(actionID string) (*Block, *Element) {
+	for i := range b {
+		block := &b[i]
+		if block.Type == BlockForm && block.BlockID == actionID {
+			return block, nil
+		}
+		if block.Type != BlockActions {
+			continue
+		}
+		for j := range block.Elements {
+			if block.Elements[j].ActionID == actionID {
+				return block, &block.Elements[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// HasOption reports whether a select menu offers a value.
+func (e Element) HasOption(value string) bool {
+	for _, option := range e.Options {
+		if option.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageInteraction records a click or form submission on an interactive
+// message, which the handling bot answers by its ID.
+type MessageInteraction struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	MessageID uint      `json:"message_id" gorm:"index"`
+	UserID    uint      `json:"user_id"`     // Who interacted
+	BotUserID uint      `json:"bot_user_id"` // The message's sender, which handles it
+	ActionID  string    `json:"action_id"`
+}
@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// Bot holds the credentials of a bot user created through the bot API. The
+// API key itself is only shown when created; its SHA-256 hash is stored.
+type Bot struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex"` // The bot's user account
+	OwnerID    uint      `json:"owner_id" gorm:"index"`
+	APIKeyHash string    `json:"-" gorm:"uniqueIndex"`
+}
+
+// SlashCommand routes messages starting with /Command to a bot. Rows are
+// hard-deleted so a command can be registered again.
+type SlashCommand struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	BotUserID   uint      `json:"bot_user_id" gorm:"uniqueIndex:idx_bot_command"`
+	Command     string    `json:"command" gorm:"uniqueIndex:idx_bot_command"` // Without the slash
+	Description string    `json:"description"`
+	Usage       string    `json:"usage"` // e.g. "[environment]"
+}
+
+// CommandInvocation records a slash command sent to a bot, which the bot
+// answers by its ID.
+type CommandInvocation struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	BotUserID  uint      `json:"bot_user_id" gorm:"index"`
+	Command    string    `json:"command"`
+	Args       string    `json:"args"`
+	UserID     uint      `json:"user_id"`     // Who invoked the command
+	GroupID    uint      `json:"group_id"`    // 0 in a direct conversation with the bot
+	ReceiverID uint      `json:"receiver_id"` // The bot, in a direct conversation
+}
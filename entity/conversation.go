@@ -0,0 +1,48 @@
+package entity
+
+import "time"
+
+const (
+	ConversationTypeDirect = "direct"
+	ConversationTypeGroup  = "group"
+)
+
+// Conversation is a message thread: a direct pair, identified by LowUserID
+// and HighUserID (smaller ID first), or a group. Direct conversations are
+// created with their first message; group conversations mirror the group,
+// whose members are the participants.
+type Conversation struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Type       string    `json:"type"`
+	GroupID    uint      `json:"group_id" gorm:"uniqueIndex:idx_conversation_key"`
+	LowUserID  uint      `json:"low_user_id" gorm:"uniqueIndex:idx_conversation_key"`
+	HighUserID uint      `json:"high_user_id" gorm:"uniqueIndex:idx_conversation_key"`
+	MessageTTL int       `json:"message_ttl"`                           // Direct only, groups use Group.MessageTTL; 0 keeps messages
+	LastSeq    uint64    `json:"last_seq" gorm:"->;not null;default:0"` // Sequence number of the latest message; only advanced by the message pipeline
+
+	Participants []ConversationParticipant `json:"participants,omitempty"`
+}
+
+// ConversationParticipant lists a user in a direct conversation.
+type ConversationParticipant struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uint      `json:"conversation_id" gorm:"uniqueIndex:idx_participant"`
+	UserID         uint      `json:"user_id" gorm:"uniqueIndex:idx_participant;index"`
+}
+
+// DirectConversation returns the key of the direct conversation between two users.
+func DirectConversation(a, b uint) Conversation {
+	low, high := Message{SenderID: a, ReceiverID: b}.DirectPair()
+	return Conversation{Type: ConversationTypeDirect, LowUserID: low, HighUserID: high}
+}
+
+// Peer returns the other participant of a direct conversation.
+func (c Conversation) Peer(userID uint) uint {
+	if c.LowUserID == userID {
+		return c.HighUserID
+	}
+	return c.LowUserID
+}
@@ -1,15 +1,159 @@
 package entity
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
+const (
+	GroupVisibilityPublic   = "public"   // Listed in the directory; anyone can join
+	GroupVisibilityPrivate  = "private"  // Hidden from the directory; invite only
+	GroupVisibilityApproval = "approval" // Listed in the directory; joining requires admin approval
+)
+
+const (
+	GroupTypeGroup   = "group"
+	GroupTypeChannel = "channel" // Announcement channel: only owners and admins post, members subscribe
+)
+
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
 
 type Group struct {
 	gorm.Model
-	Name    string
-	Members []GroupMember
+	Name        string
+	Type        string `gorm:"default:group"`
+	Description string
+	AvatarURL   string
+	Visibility  string     `gorm:"default:public;index"`
+	ArchivedAt  *time.Time // Archived groups are read-only; nil if active
+	SlowMode    int        // Minimum seconds between messages per member; 0 disables slow mode
+	MessageTTL  int        // Seconds until new messages disappear; 0 keeps them
+	MemberCount int        // Active members (subscribers for channels), kept in sync by GroupMember hooks
+	Members     []GroupMember
 }
 
 type GroupMember struct {
 	gorm.Model
-	GroupID uint
-	UserID  uint
+	GroupID    uint
+	UserID     uint
+	Role       string     `gorm:"default:member"`
+	MutedUntil *time.Time // Member can read but not send until this time
+
+	// NotificationsMuted is the member's own preference; clients stay quiet
+	// for the group's messages but mentions are still notified.
+	NotificationsMuted bool
+}
+
+// IsAdmin reports whether the member may manage the group (owners included).
+func (m GroupMember) IsAdmin() bool {
+	return m.Role == GroupRoleOwner || m.Role == GroupRoleAdmin
+}
+
+// AfterCreate keeps the group's member count in sync.
+func (m *GroupMember) AfterCreate(tx *gorm.DB) error {
+	return tx.Model(&Group{}).Where("id = ?", m.GroupID).UpdateColumn("member_count", gorm.Expr("member_count + 1")).Error
+}
+
+// AfterDelete keeps the group's member count in sync when a loaded member
+// is removed. Batch deletes (GroupID unset) happen only when the whole group
+// is deleted, so they are skipped.
+func (m *GroupMember) AfterDelete(tx *gorm.DB) error {
+	if m.GroupID == 0 {
+		return nil
+	}
+	return tx.Model(&Group{}).Where("id = ?", m.GroupID).UpdateColumn("member_count", gorm.Expr("member_count - 1")).Error
+}
+
+// IsMuted reports whether the member is muted at the given time.
+func (m GroupMember) IsMuted(now time.Time) bool {
+	return m.MutedUntil != nil && now.Before(*m.MutedUntil)
+}
+
+// CanModerate reports whether the member may mute, ban or otherwise moderate
+// the target. Admins moderate members; only owners moderate admins.
+func (m GroupMember) CanModerate(target GroupMember) bool {
+	switch target.Role {
+	case GroupRoleOwner:
+		return false
+	case GroupRoleAdmin:
+		return m.Role == GroupRoleOwner
+	default:
+		return m.IsAdmin()
+	}
+}
+
+type GroupInvite struct {
+	gorm.Model
+	GroupID   uint       `json:"group_id"`
+	Token     string     `json:"token" gorm:"uniqueIndex"`
+	CreatedBy uint       `json:"created_by"`
+	Role      string     `json:"role" gorm:"default:member"` // Role granted to users joining through this invite
+	ExpiresAt *time.Time `json:"expires_at"`                 // Nil if the invite never expires
+	MaxUses   int        `json:"max_uses"`                   // 0 means unlimited
+	Uses      int        `json:"uses"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// Usable reports whether the invite can still be redeemed at the given time.
+func (i GroupInvite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+type GroupJoinRequest struct {
+	gorm.Model
+	GroupID    uint       `json:"group_id" gorm:"index"`
+	UserID     uint       `json:"user_id"`
+	Status     string     `json:"status" gorm:"default:pending"`
+	ReviewedBy uint       `json:"reviewed_by"` // Admin who approved or rejected; 0 while pending
+	ReviewedAt *time.Time `json:"reviewed_at"`
+}
+
+// ValidGroupVisibility reports whether v is a known visibility setting.
+func ValidGroupVisibility(v string) bool {
+	return v == GroupVisibilityPublic || v == GroupVisibilityPrivate || v == GroupVisibilityApproval
+}
+
+// GroupBan keeps a user out of a group. Unbanning soft-deletes the row.
+type GroupBan struct {
+	gorm.Model
+	GroupID  uint   `json:"group_id" gorm:"index"`
+	UserID   uint   `json:"user_id"`
+	BannedBy uint   `json:"banned_by"`
+	Reason   string `json:"reason"`
+}
+
+const (
+	ModerationMute     = "mute"
+	ModerationUnmute   = "unmute"
+	ModerationBan      = "ban"
+	ModerationUnban    = "unban"
+	ModerationSlowMode = "slow_mode"
+)
+
+// GroupAuditLog is an append-only record of moderation actions in a group.
+type GroupAuditLog struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time `json:"created_at"`
+	GroupID      uint      `json:"group_id" gorm:"index"`
+	ActorID      uint      `json:"actor_id"`
+	Action       string    `json:"action"`
+	TargetUserID uint      `json:"target_user_id"` // 0 for group-wide actions such as slow mode
+	Details      string    `json:"details"`
 }
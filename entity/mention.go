@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+const (
+	MentionUser = "user" // @username
+	MentionAll  = "all"  // @all: every member
+	MentionHere = "here" // @here: members online when the message was sent
+)
+
+// Mention records that a user was mentioned in a group message.
+type Mention struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	MessageID uint      `json:"message_id" gorm:"index"`
+	GroupID   uint      `json:"group_id"`
+	SenderID  uint      `json:"sender_id"`
+	UserID    uint      `json:"user_id" gorm:"index"` // The mentioned user
+	Kind      string    `json:"kind"`
+}
@@ -6,12 +6,104 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	MessageKindText   = "text"
+	MessageKindSystem = "system" // Generated by the server, e.g. membership events
+)
+
+const (
+	MessageFormatPlain    = "plain"
+	MessageFormatMarkdown = "markdown" // Rendered by clients; the server stores the source
+)
+
+// System events carried by messages of kind MessageKindSystem.
+const (
+	SystemEventJoined       = "joined"
+	SystemEventLeft         = "left"
+	SystemEventRemoved      = "removed"
+	SystemEventRenamed      = "renamed"
+	SystemEventRoleChanged  = "role_changed"
+	SystemEventUpdated      = "updated"
+	SystemEventArchived     = "archived"
+	SystemEventUnarchived   = "unarchived"
+	SystemEventAnnouncement = "announcement"  // Server-wide announcement from an administrator
+	SystemEventTimerChanged = "timer_changed" // Disappearing message timer was changed
+)
+
 type Message struct {
 	gorm.Model
-	SenderID      uint       `json:"sender_id"`
-	ReceiverID    uint       `json:"receiver_id"` // For direct messages; 0 if group message
-	GroupID       uint       `json:"group_id"`    // 0 if not a group message
-	Content       string     `json:"content"`
-	ScheduledTime *time.Time `json:"scheduled_time"` // Nil if sent immediately
-	Sent          bool       `json:"sent" gorm:"default:false"`
+	SenderID       uint       `json:"sender_id"`
+	ReceiverID     uint       `json:"receiver_id"`                  // For direct messages; 0 if group message
+	GroupID        uint       `json:"group_id"`                     // 0 if not a group message
+	ConversationID uint       `json:"conversation_id" gorm:"index"` // Set when the message is sent
+	Seq            uint64     `json:"seq"`                          // Gapless position within the conversation; 0 until delivered
+	Content        string     `json:"content"`
+	Format         string     `json:"format" gorm:"default:plain"`
+	Blocks         Blocks     `json:"blocks,omitempty" gorm:"type:jsonb"` // Interactive content from bots; Content is the fallback
+	ClientMsgID    string     `json:"client_msg_id,omitempty"`            // Chosen by the sender to make resends idempotent
+	Kind           string     `json:"kind" gorm:"default:text"`
+	SystemEvent    string     `json:"system_event,omitempty"`   // Set for system messages only
+	ActorID        uint       `json:"actor_id,omitempty"`       // User who triggered a system event
+	TargetUserID   uint       `json:"target_user_id,omitempty"` // User a system event is about
+	ScheduledTime  *time.Time `json:"scheduled_time"`           // Nil if sent immediately
+	Sent           bool       `json:"sent" gorm:"default:false"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" gorm:"index"` // Set when the conversation has a disappearing timer
+
+	// SendError is why a scheduled message was rejected when it was due.
+	// Rejected messages stay unsent and are not retried.
+	SendError string `json:"send_error,omitempty" gorm:"not null;default:''"`
+
+	// Provenance of a forwarded message. The original sender is always kept;
+	// the original group and message only when the group is public.
+	ForwardedFromSenderID  uint `json:"forwarded_from_sender_id,omitempty"`
+	ForwardedFromGroupID   uint `json:"forwarded_from_group_id,omitempty"`
+	ForwardedFromMessageID uint `json:"forwarded_from_message_id,omitempty"`
+
+	AttachmentIDs []uint       `json:"attachment_ids,omitempty" gorm:"-"` // Set by clients when sending
+	Attachments   []Attachment `json:"attachments,omitempty" gorm:"-"`    // Loaded by the server for delivery
+	Mentions      []uint       `json:"mentions,omitempty" gorm:"-"`       // Mentioned user IDs, resolved by the server
+
+	// ForwardedAttachments are copied to a forwarded message once it is
+	// stored, so a rejected forward leaves no copies behind.
+	ForwardedAttachments []Attachment `json:"-" gorm:"-"`
+}
+
+// MessageReaction is an emoji reaction by a user to a message. Rows are
+// hard-deleted when the reaction is removed so it can be added again.
+type MessageReaction struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	MessageID uint      `json:"message_id" gorm:"uniqueIndex:idx_reaction"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_reaction"`
+	Emoji     string    `json:"emoji" gorm:"uniqueIndex:idx_reaction"`
+}
+
+// PinnedMessage pins a message to its conversation.
+type PinnedMessage struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time `json:"created_at"`
+	MessageID      uint      `json:"message_id" gorm:"uniqueIndex"`
+	ConversationID uint      `json:"conversation_id" gorm:"index"`
+	PinnedBy       uint      `json:"pinned_by"`
+}
+
+// StarredMessage saves a message to a user's personal list.
+type StarredMessage struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_starred"`
+	MessageID uint      `json:"message_id" gorm:"uniqueIndex:idx_starred"`
+}
+
+// IsForwarded reports whether the message is a forwarded copy.
+func (m Message) IsForwarded() bool {
+	return m.ForwardedFromSenderID != 0
+}
+
+// DirectPair returns the two participants of a direct message, smaller ID first.
+func (m Message) DirectPair() (low, high uint) {
+	if m.SenderID < m.ReceiverID {
+		return m.SenderID, m.ReceiverID
+	}
+	return m.ReceiverID, m.SenderID
 }
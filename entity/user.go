@@ -1,13 +1,33 @@
 package entity
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin" // Server-wide administrator
+	UserRoleBot   = "bot"   // Posts on behalf of an integration; cannot log in
+)
+
 type User struct {
 	gorm.Model
-	Username string `gorm:"unique"`
-	Password string
+	Username   string `gorm:"unique"`
+	Password   string
+	Role       string     `gorm:"default:user"`
+	DisabledAt *time.Time // Disabled accounts cannot log in or connect; nil if active
+}
+
+// IsBot reports whether the user is an integration's bot identity.
+func (u User) IsBot() bool {
+	return u.Role == UserRoleBot
+}
+
+// IsAdmin reports whether the user is a server administrator.
+func (u User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
 }
 
 type BlockedUser struct {
@@ -15,3 +35,14 @@ type BlockedUser struct {
 	UserID    uint // Who blocked
 	BlockedID uint // Who is blocked
 }
+
+// AdminAuditLog is an append-only record of actions taken through the admin API.
+type AdminAuditLog struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	AdminID    uint      `json:"admin_id" gorm:"index"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"` // user, group, webhook or server
+	TargetID   uint      `json:"target_id"`
+	Details    string    `json:"details"`
+}
@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	WebhookEventMessageCreated = "message.created"
+	WebhookEventMemberAdded    = "member.added"
+	WebhookEventMemberRemoved  = "member.removed" // Left, removed or banned
+	WebhookEventUserBlocked    = "user.blocked"
+	WebhookEventUserUnblocked  = "user.unblocked"
+)
+
+// WebhookEvents lists the event types a webhook can subscribe to.
+var WebhookEvents = []string{
+	WebhookEventMessageCreated,
+	WebhookEventMemberAdded,
+	WebhookEventMemberRemoved,
+	WebhookEventUserBlocked,
+	WebhookEventUserUnblocked,
+}
+
+const (
+	DeliveryPending   = "pending" // Waiting for its first attempt or a retry
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // Out of retries; listed as a dead letter
+)
+
+// Webhook is an HTTPS endpoint registered by an administrator to receive
+// server events. Deleting it soft-deletes the row and stops deliveries.
+type Webhook struct {
+	gorm.Model
+	URL       string `json:"url"`
+	Events    string `json:"events"` // Comma-separated event types
+	Secret    string `json:"-"`      // Key of the HMAC signature; shown once on creation
+	CreatedBy uint   `json:"created_by"`
+}
+
+// Subscribes reports whether the webhook receives an event type.
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range strings.Split(w.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one webhook, kept as the delivery
+// log. Failed attempts are retried with exponential backoff until the
+// delivery succeeds or runs out of attempts and becomes a dead letter.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	WebhookID      uint       `json:"webhook_id" gorm:"index"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"` // Request body, signed as sent
+	Status         string     `json:"status" gorm:"default:pending;index"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"` // nil once delivered or dead
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// IncomingWebhook lets an external system post into a group through a
+// secret URL. Its messages are sent by a bot user that is a member of the
+// group while the webhook is active.
+type IncomingWebhook struct {
+	gorm.Model
+	GroupID     uint       `json:"group_id" gorm:"index"`
+	Name        string     `json:"name"`
+	Token       string     `json:"-" gorm:"uniqueIndex"`
+	BotUserID   uint       `json:"bot_user_id"`
+	CallbackURL string     `json:"callback_url,omitempty"` // Receives interactions with the bot's messages
+	CreatedBy   uint       `json:"created_by"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
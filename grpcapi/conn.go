@@ -0,0 +1,72 @@
+package grpcapi
+
+import (
+	"chat_app/genproto/chatpb"
+	"chat_app/services"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamConn adapts a Chat stream to services.Conn. The WebSocket service
+// writes JSON frames, which are converted to protobuf here; incoming
+// protobuf frames are handed over as JSON messages.
+type streamConn struct {
+	stream    chatpb.ChatService_ChatServer
+	mu        sync.Mutex // Keeps Send from running once Chat may return
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var errStreamClosed = errors.New("stream closed")
+
+func newStreamConn(stream chatpb.ChatService_ChatServer) *streamConn {
+	return &streamConn{stream: stream, closed: make(chan struct{})}
+}
+
+func (c *streamConn) ReadJSON(v interface{}) error {
+	for {
+		frame, err := c.stream.Recv()
+		if err != nil {
+			return err
+		}
+		if ok, err := services.DecodeClientFrame(frame, v); ok || err != nil {
+			return err
+		}
+	}
+}
+
+func (c *streamConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// WriteMessage sends a JSON frame. The WebSocket service writes from a
+// single goroutine per connection, as gRPC requires.
+func (c *streamConn) WriteMessage(_ int, data []byte) error {
+	frame, err := services.EncodeProtoFrame(data)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+		return errStreamClosed
+	default:
+	}
+	return c.stream.Send(frame)
+}
+
+// Close ends the stream; Chat returns once it is closed.
+func (c *streamConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
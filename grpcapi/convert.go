@@ -0,0 +1,45 @@
+package grpcapi
+
+import (
+	"chat_app/entity"
+	"chat_app/genproto/chatpb"
+	"chat_app/services"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func userToProto(user entity.User) *chatpb.User {
+	return &chatpb.User{
+		Id:         uint64(user.ID),
+		Username:   user.Username,
+		Role:       user.Role,
+		CreatedAt:  timestamppb.New(user.CreatedAt),
+		DisabledAt: services.Timestamp(user.DisabledAt),
+	}
+}
+
+func groupToProto(group entity.Group) *chatpb.Group {
+	return &chatpb.Group{
+		Id:          uint64(group.ID),
+		Name:        group.Name,
+		Type:        group.Type,
+		Description: group.Description,
+		AvatarUrl:   group.AvatarURL,
+		Visibility:  group.Visibility,
+		ArchivedAt:  services.Timestamp(group.ArchivedAt),
+		SlowMode:    int32(group.SlowMode),
+		MessageTtl:  int32(group.MessageTTL),
+		MemberCount: int32(group.MemberCount),
+		CreatedAt:   timestamppb.New(group.CreatedAt),
+	}
+}
+
+func groupMemberToProto(member entity.GroupMember) *chatpb.GroupMember {
+	return &chatpb.GroupMember{
+		GroupId:            uint64(member.GroupID),
+		UserId:             uint64(member.UserID),
+		Role:               member.Role,
+		MutedUntil:         services.Timestamp(member.MutedUntil),
+		NotificationsMuted: member.NotificationsMuted,
+	}
+}
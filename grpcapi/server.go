@@ -0,0 +1,151 @@
+package grpcapi
+
+import (
+	"chat_app/entity"
+	"chat_app/genproto/chatpb"
+	"chat_app/services"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// Server implements chatpb.ChatServiceServer on top of the same services as
+// the HTTP API.
+type Server struct {
+	chatpb.UnimplementedChatServiceServer
+	AuthService      *services.AuthService
+	GroupService     *services.GroupService
+	WebSocketService *services.WebSocketService
+}
+
+func NewServer(authService *services.AuthService, groupService *services.GroupService, wsService *services.WebSocketService) *grpc.Server {
+	server := grpc.NewServer()
+	chatpb.RegisterChatServiceServer(server, &Server{
+		AuthService:      authService,
+		GroupService:     groupService,
+		WebSocketService: wsService,
+	})
+	return server
+}
+
+// metadataValue returns the first value of a metadata entry, or "".
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// callerID identifies the user a call acts as from the user-id metadata
+// entry. Disabled accounts and bots without their API key in the
+// authorization entry are rejected as on the HTTP API.
+func (s *Server) callerID(ctx context.Context) (uint, error) {
+	userID, err := strconv.Atoi(metadataValue(ctx, "user-id"))
+	if err != nil || userID <= 0 {
+		return 0, status.Error(codes.Unauthenticated, "user-id metadata is required")
+	}
+	var user entity.User
+	if err := s.AuthService.DB.First(&user, userID).Error; err != nil {
+		return 0, status.Error(codes.Unauthenticated, "unknown user")
+	}
+	if user.DisabledAt != nil {
+		return 0, status.Error(codes.PermissionDenied, "account is disabled")
+	}
+	if err := s.AuthService.VerifyBot(&user, metadataValue(ctx, "authorization")); err != nil {
+		return 0, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return user.ID, nil
+}
+
+// Chat serves the real-time stream through the WebSocket service, so stream
+// clients get the same checks, acks and frames as WebSocket clients.
+func (s *Server) Chat(stream chatpb.ChatService_ChatServer) error {
+	userID, err := s.callerID(stream.Context())
+	if err != nil {
+		return err
+	}
+	log.Printf("gRPC chat stream opened for user %d", userID)
+
+	conn := newStreamConn(stream)
+	served := make(chan struct{})
+	go func() {
+		s.WebSocketService.Serve(conn, userID, metadataValue(stream.Context(), "resume-token"), metadataValue(stream.Context(), "last-seq"))
+		close(served)
+	}()
+
+	// Returning ends the stream, which also stops Serve's reads
+	select {
+	case <-served:
+	case <-conn.closed:
+	}
+	return nil
+}
+
+func (s *Server) GetUser(ctx context.Context, req *chatpb.GetUserRequest) (*chatpb.User, error) {
+	if _, err := s.callerID(ctx); err != nil {
+		return nil, err
+	}
+	var user entity.User
+	if err := s.AuthService.DB.First(&user, req.GetUserId()).Error; err != nil {
+		return nil, notFoundOr(err, "user not found")
+	}
+	return userToProto(user), nil
+}
+
+// loadVisibleGroup returns a group the caller may see: listed groups are
+// visible to everyone, private ones to their members only.
+func (s *Server) loadVisibleGroup(ctx context.Context, groupID uint64) (*entity.Group, error) {
+	userID, err := s.callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var group entity.Group
+	if err := s.GroupService.DB.First(&group, groupID).Error; err != nil {
+		return nil, notFoundOr(err, "group not found")
+	}
+	if group.Visibility == entity.GroupVisibilityPrivate {
+		if _, err := s.GroupService.GetMember(group.ID, userID); err != nil {
+			return nil, status.Error(codes.NotFound, "group not found")
+		}
+	}
+	return &group, nil
+}
+
+func (s *Server) GetGroup(ctx context.Context, req *chatpb.GetGroupRequest) (*chatpb.Group, error) {
+	group, err := s.loadVisibleGroup(ctx, req.GetGroupId())
+	if err != nil {
+		return nil, err
+	}
+	return groupToProto(*group), nil
+}
+
+func (s *Server) ListGroupMembers(ctx context.Context, req *chatpb.ListGroupMembersRequest) (*chatpb.ListGroupMembersResponse, error) {
+	group, err := s.loadVisibleGroup(ctx, req.GetGroupId())
+	if err != nil {
+		return nil, err
+	}
+	var members []entity.GroupMember
+	if err := s.GroupService.DB.Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
+		return nil, status.Error(codes.Internal, "error fetching group members")
+	}
+	resp := &chatpb.ListGroupMembersResponse{}
+	for _, member := range members {
+		resp.Members = append(resp.Members, groupMemberToProto(member))
+	}
+	return resp, nil
+}
+
+func notFoundOr(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status.Error(codes.NotFound, message)
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"chat_app/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type adminContextKey struct{}
+
+// RequireAdmin rejects requests whose user_id query parameter does not
+// belong to an active server administrator.
+func (h *Handler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminID, err := queryUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !h.AdminService.IsAdmin(adminID) {
+			http.Error(w, "Administrator access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, adminID)))
+	})
+}
+
+// adminID returns the administrator authenticated by RequireAdmin.
+func adminID(r *http.Request) uint {
+	id, _ := r.Context().Value(adminContextKey{}).(uint)
+	return id
+}
+
+// loadTargetUser parses the target_id path variable and fetches the user,
+// writing the error response itself when it returns false.
+func (h *Handler) loadTargetUser(w http.ResponseWriter, r *http.Request) (*entity.User, bool) {
+	targetID, err := strconv.Atoi(mux.Vars(r)["target_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var user entity.User
+	if err := h.AdminService.DB.First(&user, targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &user, true
+}
+
+type adminUserView struct {
+	ID         uint       `json:"id"`
+	Username   string     `json:"username"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func (h *Handler) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := parsePagination(r)
+
+	query := h.AdminService.DB.Model(&entity.User{})
+	if q := r.URL.Query().Get("q"); q != "" {
+		query = query.Where("username ILIKE ?", "%"+q+"%")
+	}
+	switch r.URL.Query().Get("status") {
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	case "active":
+		query = query.Where("disabled_at IS NULL")
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+	users := []adminUserView{}
+	if err := query.Select("id, username, role, created_at, disabled_at").
+		Order("id").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&users).Error; err != nil {
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// AdminDisableUser disables an account and drops its live connections.
+func (h *Handler) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.ID == adminID(r) {
+		http.Error(w, "Cannot disable yourself", http.StatusBadRequest)
+		return
+	}
+	if user.DisabledAt != nil {
+		http.Error(w, "User is already disabled", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AdminService.DB.Model(user).Update("disabled_at", time.Now().UTC()).Error; err != nil {
+		http.Error(w, "Error disabling user", http.StatusInternalServerError)
+		return
+	}
+	closed := h.WebSocketService.DisconnectUser(user.ID, "Your account has been disabled.")
+	h.AdminService.Log(adminID(r), services.AdminActionDisableUser, "user", user.ID, fmt.Sprintf("closed %d connections", closed))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "User disabled",
+		"connections_closed": closed,
+	})
+}
+
+func (h *Handler) AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.DisabledAt == nil {
+		http.Error(w, "User is not disabled", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AdminService.DB.Model(user).Update("disabled_at", nil).Error; err != nil {
+		http.Error(w, "Error enabling user", http.StatusInternalServerError)
+		return
+	}
+	h.AdminService.Log(adminID(r), services.AdminActionEnableUser, "user", user.ID, "")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User enabled",
+	})
+}
+
+func (h *Handler) AdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+	if err := h.AdminService.DB.Model(user).Update("password", string(hashedPassword)).Error; err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+	h.AdminService.Log(adminID(r), services.AdminActionResetPassword, "user", user.ID, "")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password reset",
+	})
+}
+
+func (h *Handler) AdminChangeRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role != entity.UserRoleUser && req.Role != entity.UserRoleAdmin {
+		http.Error(w, "Role must be user or admin", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.ID == adminID(r) {
+		http.Error(w, "Cannot change your own role", http.StatusBadRequest)
+		return
+	}
+	if user.IsBot() {
+		http.Error(w, "Bot roles cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AdminService.DB.Model(user).Update("role", req.Role).Error; err != nil {
+		http.Error(w, "Error changing role", http.StatusInternalServerError)
+		return
+	}
+	h.AdminService.Log(adminID(r), services.AdminActionChangeRole, "user", user.ID, req.Role)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":   user.ID,
+		"role": req.Role,
+	})
+}
+
+func (h *Handler) AdminDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	deleteMessages := r.URL.Query().Get("delete_messages") == "true"
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+
+	memberIDs, err := h.GroupService.MemberIDs(group.ID)
+	if err != nil {
+		http.Error(w, "Error fetching group members", http.StatusInternalServerError)
+		return
+	}
+	if err := h.GroupService.DeleteGroup(group.ID, deleteMessages); err != nil {
+		log.Printf("Error deleting group %d: %v", group.ID, err)
+		http.Error(w, "Error deleting group", http.StatusInternalServerError)
+		return
+	}
+	h.AdminService.Log(adminID(r), services.AdminActionDeleteGroup, "group", group.ID, fmt.Sprintf("name=%q delete_messages=%t", group.Name, deleteMessages))
+
+	h.WebSocketService.SendToUsers(memberIDs, map[string]interface{}{
+		"event":    "group_deleted",
+		"group_id": group.ID,
+		"content":  fmt.Sprintf("The group %q was deleted by an administrator", group.Name),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Group deleted",
+		"messages_deleted": deleteMessages,
+	})
+}
+
+func (h *Handler) AdminAnnounce(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Content == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+
+	h.WebSocketService.SendAnnouncement(adminID(r), req.Content)
+	h.AdminService.Log(adminID(r), services.AdminActionAnnouncement, "server", 0, req.Content)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Announcement sent",
+	})
+}
+
+func (h *Handler) AdminStats(w http.ResponseWriter, r *http.Request) {
+	var users, disabledUsers, groups, messages, messagesToday int64
+	db := h.AdminService.DB
+	counts := []struct {
+		dest  *int64
+		query *gorm.DB
+	}{
+		{&users, db.Model(&entity.User{})},
+		{&disabledUsers, db.Model(&entity.User{}).Where("disabled_at IS NOT NULL")},
+		{&groups, db.Model(&entity.Group{})},
+		{&messages, db.Model(&entity.Message{})},
+		{&messagesToday, db.Model(&entity.Message{}).Where("created_at >= ?", time.Now().UTC().Add(-24*time.Hour))},
+	}
+	for _, c := range counts {
+		if err := c.query.Count(c.dest).Error; err != nil {
+			http.Error(w, "Error fetching stats", http.StatusInternalServerError)
+			return
+		}
+	}
+	connections, onlineUsers := h.WebSocketService.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":              users,
+		"disabled_users":     disabledUsers,
+		"groups":             groups,
+		"messages":           messages,
+		"messages_last_24h":  messagesToday,
+		"online_users":       onlineUsers,
+		"online_connections": connections,
+	})
+}
+
+func (h *Handler) AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := parsePagination(r)
+
+	var entries []entity.AdminAuditLog
+	if err := h.AdminService.DB.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&entries).Error; err != nil {
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"chat_app/services"
+	"chat_app/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// multipartOverhead leaves room for form boundaries and headers on top of
+// the largest accepted file.
+const multipartOverhead = 1 << 20
+
+// UploadAttachment stores a file sent as the "file" field of a multipart
+// form. The returned ID can be listed in a message's attachment_ids.
+func (h *Handler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.AttachmentService.Config.MaxUploadBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file field is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.AttachmentService.Upload(r.Context(), userID, header.Filename, header.Size, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAttachmentTooLarge):
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, services.ErrQuotaExceeded):
+			http.Error(w, "Storage quota exceeded", http.StatusForbidden)
+		case errors.Is(err, services.ErrImageMalformed):
+			http.Error(w, "Image could not be read", http.StatusBadRequest)
+		default:
+			log.Printf("Error uploading attachment for user %d: %v", userID, err)
+			http.Error(w, "Error uploading file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// loadAttachment fetches an attachment the user may read: their own upload,
+// or a file sent in a conversation they can access.
+func (h *Handler) loadAttachment(w http.ResponseWriter, r *http.Request, userID uint) (*entity.Attachment, bool) {
+	attachmentID, err := strconv.Atoi(mux.Vars(r)["attachment_id"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var attachment entity.Attachment
+	if err := h.AttachmentService.DB.First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding attachment", http.StatusInternalServerError)
+		return nil, false
+	}
+	if attachment.UploaderID == userID {
+		return &attachment, true
+	}
+
+	var msg entity.Message
+	if attachment.MessageID == 0 || h.MessageService.DB.First(&msg, attachment.MessageID).Error != nil || !h.MessageService.CanAccess(userID, &msg) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &attachment, true
+}
+
+func (h *Handler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attachment, ok := h.loadAttachment(w, r, userID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	h.streamBlob(w, r, attachment.StorageKey)
+}
+
+func (h *Handler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.downloadRendition(w, r, func(a *entity.Attachment) string { return a.ThumbnailKey })
+}
+
+func (h *Handler) DownloadPreview(w http.ResponseWriter, r *http.Request) {
+	h.downloadRendition(w, r, func(a *entity.Attachment) string { return a.PreviewKey })
+}
+
+// downloadRendition serves a rendered JPEG of an image attachment.
+func (h *Handler) downloadRendition(w http.ResponseWriter, r *http.Request, key func(*entity.Attachment) string) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attachment, ok := h.loadAttachment(w, r, userID)
+	if !ok {
+		return
+	}
+	if key(attachment) == "" {
+		http.Error(w, "Attachment has no rendered image", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	h.streamBlob(w, r, key(attachment))
+}
+
+func (h *Handler) streamBlob(w http.ResponseWriter, r *http.Request, key string) {
+	blob, err := h.AttachmentService.Store.Get(r.Context(), key)
+	if err != nil {
+		w.Header().Del("Content-Length")
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Attachment content is missing", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error reading blob %s: %v", key, err)
+		http.Error(w, "Error reading attachment", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("Error streaming blob %s: %v", key, err)
+	}
+}
+
+// DeleteAttachment removes an upload that has not been sent yet, freeing quota.
+func (h *Handler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attachment, ok := h.loadAttachment(w, r, userID)
+	if !ok {
+		return
+	}
+	if attachment.UploaderID != userID {
+		http.Error(w, "Only the uploader can delete an attachment", http.StatusForbidden)
+		return
+	}
+	if attachment.MessageID != 0 {
+		http.Error(w, "Attachment has already been sent", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AttachmentService.Delete(r.Context(), attachment); err != nil {
+		http.Error(w, "Error deleting attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Attachment %d deleted", attachment.ID),
+	})
+}
@@ -57,7 +57,6 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
-	log.Printf("Received login request headers: %v", r.Header)
 	log.Printf("Received login request body: %v", r.Body)
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		log.Printf("Failed to decode body: %v", err)
@@ -81,16 +80,26 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.IsBot() {
+		http.Error(w, "Bots authenticate with API keys", http.StatusForbidden)
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
+	if user.DisabledAt != nil {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"id":       user.ID,
 		"username": creds.Username,
+		"role":     user.Role,
 	})
 }
 
@@ -150,6 +159,10 @@ func (h *Handler) BlockUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error blocking user", http.StatusInternalServerError)
 		return
 	}
+	h.WebhookService.Dispatch(entity.WebhookEventUserBlocked, map[string]interface{}{
+		"user_id":    block.UserID,
+		"blocked_id": block.BlockedID,
+	})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -187,6 +200,10 @@ func (h *Handler) UnblockUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error unblocking user", http.StatusInternalServerError)
 		return
 	}
+	h.WebhookService.Dispatch(entity.WebhookEventUserUnblocked, map[string]interface{}{
+		"user_id":    block.UserID,
+		"blocked_id": block.BlockedID,
+	})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -0,0 +1,484 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"chat_app/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// commandResponseWindow is how long a bot may answer an invocation or an
+// interaction.
+const commandResponseWindow = 30 * time.Minute
+
+const (
+	responseEphemeral = "ephemeral"  // Only the invoker sees the response
+	responseInChannel = "in_channel" // Posted to the conversation by the bot
+)
+
+// loadOwnedBot parses the bot_id path variable and fetches the bot, which
+// must belong to the acting user.
+func (h *Handler) loadOwnedBot(w http.ResponseWriter, r *http.Request, ownerID uint) (*entity.Bot, bool) {
+	botID, err := strconv.Atoi(mux.Vars(r)["bot_id"])
+	if err != nil {
+		http.Error(w, "Invalid bot ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var bot entity.Bot
+	if err := h.AuthService.DB.Where("user_id = ?", botID).First(&bot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Bot not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding bot", http.StatusInternalServerError)
+		return nil, false
+	}
+	if bot.OwnerID != ownerID {
+		http.Error(w, "Only the bot's owner can manage it", http.StatusForbidden)
+		return nil, false
+	}
+	return &bot, true
+}
+
+// CreateBot creates a bot user owned by the caller. The API key is only
+// returned here; bots send it as "Authorization: Bot <key>".
+func (h *Handler) CreateBot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   uint   `json:"user_id"` // The owner
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if !botNamePattern.MatchString(req.Username) {
+		http.Error(w, "Username must be 1 to 32 letters, digits, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+
+	var owner entity.User
+	if err := h.AuthService.DB.First(&owner, req.UserID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if owner.IsBot() || owner.DisabledAt != nil {
+		http.Error(w, "Only active users can create bots", http.StatusForbidden)
+		return
+	}
+	var existing entity.User
+	if err := h.AuthService.DB.Unscoped().Where("username = ?", req.Username).First(&existing).Error; err == nil {
+		http.Error(w, "Username is taken", http.StatusConflict)
+		return
+	}
+
+	key, hash, err := services.NewBotAPIKey()
+	if err != nil {
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+	user := entity.User{Username: req.Username, Role: entity.UserRoleBot}
+	bot := entity.Bot{OwnerID: owner.ID, APIKeyHash: hash}
+	err = h.AuthService.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		bot.UserID = user.ID
+		return tx.Create(&bot).Error
+	})
+	if err != nil {
+		log.Printf("Error creating bot %q: %v", req.Username, err)
+		http.Error(w, "Error creating bot", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d created bot %d (%s)", owner.ID, user.ID, user.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       user.ID,
+		"username": user.Username,
+		"api_key":  key,
+	})
+}
+
+type botView struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListBots lists the caller's active bots.
+func (h *Handler) ListBots(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bots := []botView{}
+	if err := h.AuthService.DB.Table("bots").
+		Select("users.id, users.username, bots.created_at").
+		Joins("JOIN users ON users.id = bots.user_id AND users.deleted_at IS NULL AND users.disabled_at IS NULL").
+		Where("bots.owner_id = ?", userID).
+		Order("bots.id").
+		Scan(&bots).Error; err != nil {
+		http.Error(w, "Error fetching bots", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bots)
+}
+
+// RotateBotKey replaces a bot's API key; the old one stops working at once.
+func (h *Handler) RotateBotKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"` // The owner
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	bot, ok := h.loadOwnedBot(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	key, hash, err := services.NewBotAPIKey()
+	if err != nil {
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+	if err := h.AuthService.DB.Model(bot).Update("api_key_hash", hash).Error; err != nil {
+		http.Error(w, "Error rotating API key", http.StatusInternalServerError)
+		return
+	}
+	h.WebSocketService.DisconnectUser(bot.UserID, "API key was rotated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      bot.UserID,
+		"api_key": key,
+	})
+}
+
+// DeleteBot disables a bot: its key and commands are removed, it leaves its
+// groups and its connections are closed. Its messages are kept.
+func (h *Handler) DeleteBot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"` // The owner
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	bot, ok := h.loadOwnedBot(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	var memberships []entity.GroupMember
+	err := h.AuthService.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", bot.UserID).Update("disabled_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bot_user_id = ?", bot.UserID).Delete(&entity.SlashCommand{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", bot.UserID).Find(&memberships).Error; err != nil {
+			return err
+		}
+		for i := range memberships {
+			if err := tx.Delete(&memberships[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(bot).Error
+	})
+	if err != nil {
+		log.Printf("Error deleting bot %d: %v", bot.UserID, err)
+		http.Error(w, "Error deleting bot", http.StatusInternalServerError)
+		return
+	}
+	h.WebSocketService.DisconnectUser(bot.UserID, "Bot was deleted")
+	name := h.actorName(bot.UserID)
+	for _, membership := range memberships {
+		h.WebSocketService.SendGroupEvent(membership.GroupID, entity.SystemEventRemoved, req.UserID, bot.UserID, fmt.Sprintf("The bot %s was deleted", name))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Bot deleted",
+	})
+}
+
+// RegisterCommand routes /command to a bot, in the groups it is a member of
+// and in direct conversations with it. Registering it again updates it.
+func (h *Handler) RegisterCommand(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID      uint   `json:"user_id"` // The owner
+		Command     string `json:"command"`
+		Description string `json:"description"`
+		Usage       string `json:"usage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !commandNamePattern.MatchString(req.Command) {
+		http.Error(w, "Command must be 1 to 32 lowercase letters, digits, dashes or underscores, without the slash", http.StatusBadRequest)
+		return
+	}
+	if len(req.Description) > 200 || len(req.Usage) > 100 {
+		http.Error(w, "Description or usage is too long", http.StatusBadRequest)
+		return
+	}
+	bot, ok := h.loadOwnedBot(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	command := entity.SlashCommand{BotUserID: bot.UserID, Command: req.Command}
+	if err := h.AuthService.DB.Where(command).
+		Assign(entity.SlashCommand{Description: req.Description, Usage: req.Usage}).
+		FirstOrCreate(&command).Error; err != nil {
+		http.Error(w, "Error registering command", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(command)
+}
+
+func (h *Handler) UnregisterCommand(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"` // The owner
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	bot, ok := h.loadOwnedBot(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	result := h.AuthService.DB.Where("bot_user_id = ? AND command = ?", bot.UserID, mux.Vars(r)["command"]).Delete(&entity.SlashCommand{})
+	if result.Error != nil {
+		http.Error(w, "Error removing command", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Command not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Command removed",
+	})
+}
+
+type commandView struct {
+	entity.SlashCommand
+	BotUsername string `json:"bot_username"`
+}
+
+// ListCommands lists the slash commands available in a group the caller is
+// a member of, or in a direct conversation with a bot, for autocompletion.
+func (h *Handler) ListCommands(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupID, err := optionalUintParam(r, "group_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	peerID, err := optionalUintParam(r, "peer_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (groupID == 0) == (peerID == 0) {
+		http.Error(w, "Exactly one of group_id or peer_id is required", http.StatusBadRequest)
+		return
+	}
+
+	query := h.AuthService.DB.Table("slash_commands").
+		Select("slash_commands.*, users.username AS bot_username").
+		Joins("JOIN users ON users.id = slash_commands.bot_user_id AND users.deleted_at IS NULL AND users.disabled_at IS NULL")
+	if groupID != 0 {
+		if _, err := h.GroupService.GetMember(groupID, userID); err != nil {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+		query = query.Joins("JOIN group_members ON group_members.user_id = slash_commands.bot_user_id AND group_members.group_id = ? AND group_members.deleted_at IS NULL", groupID)
+	} else {
+		query = query.Where("slash_commands.bot_user_id = ?", peerID)
+	}
+	commands := []commandView{}
+	if err := query.Order("slash_commands.command").Scan(&commands).Error; err != nil {
+		http.Error(w, "Error fetching commands", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+// authenticateBot fetches the acting bot and checks the API key in the
+// Authorization header.
+func (h *Handler) authenticateBot(w http.ResponseWriter, r *http.Request, userID uint) (*entity.User, bool) {
+	var bot entity.User
+	if err := h.AuthService.DB.First(&bot, userID).Error; err != nil || bot.DisabledAt != nil {
+		http.Error(w, "Bot not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err := h.AuthService.VerifyBot(&bot, r.Header.Get("Authorization")); err != nil || !bot.IsBot() {
+		http.Error(w, services.ErrBotKey.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return &bot, true
+}
+
+// RespondToCommand lets a bot answer an invocation, either to the invoker
+// only or in the conversation the command was sent in.
+func (h *Handler) RespondToCommand(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID     uint   `json:"user_id"` // The bot
+		Visibility string `json:"visibility"`
+		Text       string `json:"text"`
+		Format     string `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Text == "" {
+		http.Error(w, "Text is required", http.StatusBadRequest)
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = responseEphemeral
+	}
+	if req.Visibility != responseEphemeral && req.Visibility != responseInChannel {
+		http.Error(w, "Visibility must be ephemeral or in_channel", http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = entity.MessageFormatPlain
+	}
+	if req.Format != entity.MessageFormatPlain && req.Format != entity.MessageFormatMarkdown {
+		http.Error(w, "Format must be plain or markdown", http.StatusBadRequest)
+		return
+	}
+
+	bot, ok := h.authenticateBot(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	var invocation entity.CommandInvocation
+	if err := h.AuthService.DB.Where("id = ? AND bot_user_id = ?", mux.Vars(r)["invocation_id"], bot.ID).First(&invocation).Error; err != nil {
+		http.Error(w, "Invocation not found", http.StatusNotFound)
+		return
+	}
+	if time.Since(invocation.CreatedAt) > commandResponseWindow {
+		http.Error(w, "The response window for this invocation has closed", http.StatusGone)
+		return
+	}
+
+	if req.Visibility == responseEphemeral {
+		h.WebSocketService.SendToUsers([]uint{invocation.UserID}, map[string]interface{}{
+			"event":         "command_response",
+			"invocation_id": invocation.ID,
+			"command":       invocation.Command,
+			"bot_id":        bot.ID,
+			"group_id":      invocation.GroupID,
+			"receiver_id":   invocation.ReceiverID,
+			"content":       req.Text,
+			"format":        req.Format,
+		})
+	} else {
+		msg := entity.Message{GroupID: invocation.GroupID, Content: req.Text, Format: req.Format}
+		if invocation.GroupID == 0 {
+			msg.ReceiverID = invocation.UserID
+		}
+		if _, err := h.WebSocketService.SubmitMessage(bot.ID, msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Response sent",
+	})
+}
+
+// RespondToInteraction lets a bot answer a click or form submission on one
+// of its messages: {"update": {"content", "format", "blocks"}} replaces the
+// message in place for everyone, {"reply", "format"} is shown to the user
+// who interacted only.
+func (h *Handler) RespondToInteraction(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"` // The bot
+		services.InteractionResponse
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	bot, ok := h.authenticateBot(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	var interaction entity.MessageInteraction
+	if err := h.AuthService.DB.Where("id = ? AND bot_user_id = ?", mux.Vars(r)["interaction_id"], bot.ID).First(&interaction).Error; err != nil {
+		http.Error(w, "Interaction not found", http.StatusNotFound)
+		return
+	}
+	if time.Since(interaction.CreatedAt) > commandResponseWindow {
+		http.Error(w, "The response window for this interaction has closed", http.StatusGone)
+		return
+	}
+
+	if err := h.WebSocketService.RespondToInteraction(interaction, req.InteractionResponse); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInteractionGone):
+			http.Error(w, err.Error(), http.StatusGone)
+		case errors.Is(err, services.ErrUpdateFailed):
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Response sent",
+	})
+}
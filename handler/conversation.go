@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// ListConversations lists the caller's direct conversations and the
+// conversations of their groups, most recently active first. Clients compare
+// last_seq with what they hold to find conversations to sync.
+func (h *Handler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, pageSize := parsePagination(r)
+
+	db := h.MessageService.DB
+	query := db.Model(&entity.Conversation{}).
+		Where("id IN (?) OR group_id IN (?)",
+			db.Model(&entity.ConversationParticipant{}).Select("conversation_id").Where("user_id = ?", userID),
+			db.Model(&entity.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error fetching conversations", http.StatusInternalServerError)
+		return
+	}
+	conversations := []entity.Conversation{}
+	if err := query.Order("updated_at DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&conversations).Error; err != nil {
+		http.Error(w, "Error fetching conversations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversations": conversations,
+		"total":         total,
+		"page":          page,
+		"page_size":     pageSize,
+	})
+}
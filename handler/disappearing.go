@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Bounds of the disappearing message timer, in seconds.
+const (
+	minMessageTTL = 60
+	maxMessageTTL = 90 * 24 * 60 * 60
+)
+
+type timerRequest struct {
+	UserID  uint `json:"user_id"` // The user changing the timer
+	Seconds int  `json:"seconds"` // 0 turns disappearing messages off
+}
+
+func decodeTimerRequest(w http.ResponseWriter, r *http.Request) (*timerRequest, bool) {
+	var req timerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if req.Seconds != 0 && (req.Seconds < minMessageTTL || req.Seconds > maxMessageTTL) {
+		http.Error(w, fmt.Sprintf("Seconds must be 0 or between %d and %d", minMessageTTL, maxMessageTTL), http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+// describeTimer builds the system message text for a timer change.
+func describeTimer(actor string, seconds int) string {
+	if seconds == 0 {
+		return fmt.Sprintf("%s turned off disappearing messages", actor)
+	}
+	return fmt.Sprintf("%s set messages to disappear after %s", actor, formatTTL(seconds))
+}
+
+func formatTTL(seconds int) string {
+	units := []struct {
+		name    string
+		seconds int
+	}{
+		{"week", 7 * 24 * 60 * 60},
+		{"day", 24 * 60 * 60},
+		{"hour", 60 * 60},
+		{"minute", 60},
+	}
+	for _, unit := range units {
+		if seconds%unit.seconds == 0 {
+			n := seconds / unit.seconds
+			if n == 1 {
+				return "1 " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// SetGroupTimer changes the disappearing message timer of a group. Only
+// messages sent afterwards are affected.
+func (h *Handler) SetGroupTimer(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeTimerRequest(w, r)
+	if !ok {
+		return
+	}
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can change the disappearing message timer", http.StatusForbidden)
+		return
+	}
+
+	if err := h.GroupService.DB.Model(group).Update("message_ttl", req.Seconds).Error; err != nil {
+		http.Error(w, "Error updating timer", http.StatusInternalServerError)
+		return
+	}
+	h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventTimerChanged, req.UserID, 0, describeTimer(h.actorName(req.UserID), req.Seconds))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// directPeer reads and checks the peer_id URL parameter.
+func (h *Handler) directPeer(w http.ResponseWriter, r *http.Request, userID uint) (uint, bool) {
+	peerID, err := strconv.Atoi(mux.Vars(r)["peer_id"])
+	if err != nil || peerID <= 0 || uint(peerID) == userID {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return 0, false
+	}
+	var peer entity.User
+	if err := h.AuthService.DB.First(&peer, peerID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, false
+	}
+	return uint(peerID), true
+}
+
+func (h *Handler) GetDirectTimer(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	peerID, ok := h.directPeer(w, r, userID)
+	if !ok {
+		return
+	}
+	conversation, err := h.MessageService.FindConversation(userID, 0, peerID)
+	if err != nil {
+		http.Error(w, "Error loading conversation", http.StatusInternalServerError)
+		return
+	}
+	if conversation == nil {
+		// Nothing sent yet, so the defaults apply
+		defaults := entity.DirectConversation(userID, peerID)
+		conversation = &defaults
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// SetDirectTimer changes the disappearing message timer of a direct
+// conversation. Either participant may change it.
+func (h *Handler) SetDirectTimer(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeTimerRequest(w, r)
+	if !ok {
+		return
+	}
+	peerID, ok := h.directPeer(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	conversation, err := h.MessageService.EnsureDirectConversation(req.UserID, peerID)
+	if err != nil {
+		http.Error(w, "Error loading conversation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.MessageService.DB.Model(conversation).Update("message_ttl", req.Seconds).Error; err != nil {
+		http.Error(w, "Error updating timer", http.StatusInternalServerError)
+		return
+	}
+	h.WebSocketService.SendDirectEvent(req.UserID, peerID, entity.SystemEventTimerChanged, describeTimer(h.actorName(req.UserID), req.Seconds))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
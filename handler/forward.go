@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"chat_app/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// ForwardMessage sends a copy of an existing message, with its attachments,
+// to a direct peer or a group. The group posting checks run here first so
+// the caller learns about a rejection; the copy then goes through the
+// WebSocket broadcast pipeline like any other send, which copies the
+// attachments once the forward is stored and reports later failures on the
+// caller's connection.
+func (h *Handler) ForwardMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID     uint `json:"user_id"`
+		ReceiverID uint `json:"receiver_id"`
+		GroupID    uint `json:"group_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if (req.ReceiverID == 0) == (req.GroupID == 0) {
+		http.Error(w, "Exactly one of receiver_id or group_id is required", http.StatusBadRequest)
+		return
+	}
+
+	original, ok := h.loadAccessibleMessage(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	if original.Kind == entity.MessageKindSystem {
+		http.Error(w, "System messages cannot be forwarded", http.StatusBadRequest)
+		return
+	}
+	if !original.Sent {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	forward := entity.Message{
+		SenderID:   req.UserID,
+		ReceiverID: req.ReceiverID,
+		GroupID:    req.GroupID,
+		Content:    original.Content,
+		Format:     original.Format,
+		Kind:       entity.MessageKindText,
+	}
+	h.setProvenance(&forward, original)
+	if err := h.WebSocketService.CheckPostable(forward); err != nil {
+		if errors.Is(err, services.ErrPostCheckFailed) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	attachments, err := h.AttachmentService.ForMessage(original.ID)
+	if err != nil {
+		http.Error(w, "Error loading attachments", http.StatusInternalServerError)
+		return
+	}
+	forward.ForwardedAttachments = attachments
+
+	log.Printf("User %d forwarding message %d (receiver_id=%d, group_id=%d)", req.UserID, original.ID, req.ReceiverID, req.GroupID)
+	h.WebSocketService.Broadcast <- forward
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Message forwarded",
+	})
+}
+
+// setProvenance records where a forwarded message came from. Forwarding a
+// forward keeps the first origin. The original conversation is only
+// referenced for public groups, whose history anyone may join to read;
+// direct and private group conversations stay hidden.
+func (h *Handler) setProvenance(forward *entity.Message, original *entity.Message) {
+	if original.IsForwarded() {
+		forward.ForwardedFromSenderID = original.ForwardedFromSenderID
+		forward.ForwardedFromGroupID = original.ForwardedFromGroupID
+		forward.ForwardedFromMessageID = original.ForwardedFromMessageID
+		return
+	}
+
+	forward.ForwardedFromSenderID = original.SenderID
+	if original.GroupID == 0 {
+		return
+	}
+	var group entity.Group
+	if err := h.GroupService.DB.Select("visibility").First(&group, original.GroupID).Error; err != nil {
+		return
+	}
+	if group.Visibility == entity.GroupVisibilityPublic {
+		forward.ForwardedFromGroupID = original.GroupID
+		forward.ForwardedFromMessageID = original.ID
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"chat_app/entity"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"net/http"
 	"strconv"
@@ -13,7 +14,10 @@ import (
 
 func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	var group struct {
-		Name string `json:"name"`
+		Name       string `json:"name"`
+		UserID     uint   `json:"user_id"`    // Creator; becomes the group owner if set
+		Visibility string `json:"visibility"` // public, private or approval; defaults to public
+		Type       string `json:"type"`       // group or channel; defaults to group
 	}
 	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -24,8 +28,41 @@ func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newGroup := entity.Group{Name: group.Name}
-	if err := h.GroupService.DB.Create(&newGroup).Error; err != nil {
+	if group.Visibility == "" {
+		group.Visibility = entity.GroupVisibilityPublic
+	}
+	if !entity.ValidGroupVisibility(group.Visibility) {
+		http.Error(w, "Visibility must be public, private or approval", http.StatusBadRequest)
+		return
+	}
+
+	if group.Type == "" {
+		group.Type = entity.GroupTypeGroup
+	}
+	if group.Type != entity.GroupTypeGroup && group.Type != entity.GroupTypeChannel {
+		http.Error(w, "Type must be group or channel", http.StatusBadRequest)
+		return
+	}
+	if group.Type == entity.GroupTypeChannel && group.UserID == 0 {
+		http.Error(w, "Channels need an owner (user_id)", http.StatusBadRequest)
+		return
+	}
+
+	newGroup := entity.Group{Name: group.Name, Type: group.Type, Visibility: group.Visibility}
+	err := h.GroupService.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newGroup).Error; err != nil {
+			return err
+		}
+		if group.UserID == 0 {
+			return nil
+		}
+		return tx.Create(&entity.GroupMember{
+			GroupID: newGroup.ID,
+			UserID:  group.UserID,
+			Role:    entity.GroupRoleOwner,
+		}).Error
+	})
+	if err != nil {
 		http.Error(w, "Error creating group", http.StatusInternalServerError)
 		return
 	}
@@ -33,20 +70,185 @@ func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":   newGroup.ID,
-		"name": newGroup.Name,
+		"id":         newGroup.ID,
+		"name":       newGroup.Name,
+		"type":       newGroup.Type,
+		"visibility": newGroup.Visibility,
 	})
 }
 
+type groupListing struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Visibility  string `json:"visibility"`
+	MemberCount int    `json:"member_count"`
+}
+
+// ListGroups is the group directory. Public and approval-required groups are
+// visible to everyone; private groups only to their members. The optional
+// q parameter filters by name.
 func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
-	var groups []entity.Group
-	if err := h.GroupService.DB.Find(&groups).Error; err != nil {
+	page, pageSize := parsePagination(r)
+	userID, _ := queryUserID(r) // Anonymous callers only see discoverable groups
+
+	query := h.GroupService.DB.Model(&entity.Group{}).
+		Where("visibility IN ? OR id IN (?)",
+			[]string{entity.GroupVisibilityPublic, entity.GroupVisibilityApproval},
+			h.GroupService.DB.Model(&entity.GroupMember{}).Select("group_id").Where("user_id = ? AND deleted_at IS NULL", userID))
+	if q := r.URL.Query().Get("q"); q != "" {
+		query = query.Where("name ILIKE ?", "%"+q+"%")
+	}
+
+	h.writeGroupListing(w, query, page, pageSize)
+}
+
+// ListMyGroups lists the groups the caller is an active member of.
+func (h *Handler) ListMyGroups(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := parsePagination(r)
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := h.GroupService.DB.Model(&entity.Group{}).
+		Where("id IN (?)", h.GroupService.DB.Model(&entity.GroupMember{}).Select("group_id").Where("user_id = ? AND deleted_at IS NULL", userID))
+
+	h.writeGroupListing(w, query, page, pageSize)
+}
+
+func (h *Handler) writeGroupListing(w http.ResponseWriter, query *gorm.DB, page, pageSize int) {
+	query = query.Session(&gorm.Session{}) // Shared by the count and the page query
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error fetching groups", http.StatusInternalServerError)
+		return
+	}
+
+	listings := []groupListing{}
+	err := query.Select("groups.id, groups.name, groups.type, groups.visibility, groups.member_count").
+		Order("groups.name").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&listings).Error
+	if err != nil {
 		http.Error(w, "Error fetching groups", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(groups)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groups":    listings,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// JoinGroup lets a user join a public group directly, or files a join
+// request for a group that requires approval. Private groups need an invite.
+func (h *Handler) JoinGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["group_id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the group exists
+	var group entity.Group
+	if err := h.GroupService.DB.First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding group", http.StatusInternalServerError)
+		return
+	}
+
+	// Check if the user exists
+	var user entity.User
+	if err := h.GroupService.DB.First(&user, req.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.GroupService.GetMember(group.ID, req.UserID); err == nil {
+		http.Error(w, "User is already in the group", http.StatusBadRequest)
+		return
+	}
+	if h.GroupService.IsBanned(group.ID, req.UserID) {
+		http.Error(w, "User is banned from this group", http.StatusForbidden)
+		return
+	}
+
+	switch group.Visibility {
+	case entity.GroupVisibilityPublic:
+		groupMember := entity.GroupMember{
+			GroupID: group.ID,
+			UserID:  req.UserID,
+		}
+		if err := h.GroupService.DB.Create(&groupMember).Error; err != nil {
+			http.Error(w, "Error adding user to group", http.StatusInternalServerError)
+			return
+		}
+		h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventJoined, user.ID, user.ID, fmt.Sprintf("%s joined the group", user.Username))
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"group_id": group.ID,
+			"user_id":  req.UserID,
+		})
+
+	case entity.GroupVisibilityApproval:
+		var existing entity.GroupJoinRequest
+		if err := h.GroupService.DB.Where("group_id = ? AND user_id = ? AND status = ?", group.ID, req.UserID, entity.JoinRequestPending).First(&existing).Error; err == nil {
+			http.Error(w, "Join request is already pending", http.StatusBadRequest)
+			return
+		}
+
+		joinRequest := entity.GroupJoinRequest{
+			GroupID: group.ID,
+			UserID:  req.UserID,
+			Status:  entity.JoinRequestPending,
+		}
+		if err := h.GroupService.DB.Create(&joinRequest).Error; err != nil {
+			http.Error(w, "Error creating join request", http.StatusInternalServerError)
+			return
+		}
+
+		// Let connected admins know there is a request to review
+		if adminIDs, err := h.GroupService.AdminIDs(group.ID); err == nil {
+			h.WebSocketService.SendToUsers(adminIDs, map[string]interface{}{
+				"event":      "join_request",
+				"group_id":   group.ID,
+				"request_id": joinRequest.ID,
+				"user_id":    req.UserID,
+				"username":   user.Username,
+			})
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(joinRequest)
+
+	default:
+		http.Error(w, "This group is invite only", http.StatusForbidden)
+	}
 }
 
 func (h *Handler) HandleGroupMembers(w http.ResponseWriter, r *http.Request) {
@@ -70,16 +272,19 @@ func (h *Handler) HandleGroupMembers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// AddUserToGroup adds a user to a group on behalf of one of its admins.
+// Everyone else joins through JoinGroup, an invite or a join request.
 func (h *Handler) AddUserToGroup(w http.ResponseWriter, r *http.Request, groupID uint) {
 	var member struct {
-		UserID uint `json:"user_id"`
+		UserID  uint `json:"user_id"`  // The user to add
+		AdminID uint `json:"admin_id"` // The admin adding them
 	}
 	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if member.UserID == 0 {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	if member.UserID == 0 || member.AdminID == 0 {
+		http.Error(w, "user_id and admin_id are required", http.StatusBadRequest)
 		return
 	}
 
@@ -93,6 +298,11 @@ func (h *Handler) AddUserToGroup(w http.ResponseWriter, r *http.Request, groupID
 		http.Error(w, "Error finding group", http.StatusInternalServerError)
 		return
 	}
+	actor, err := h.GroupService.GetMember(groupID, member.AdminID)
+	if err != nil || !actor.IsAdmin() {
+		http.Error(w, "Only group admins can add members", http.StatusForbidden)
+		return
+	}
 
 	// Check if the user exists
 	var user entity.User
@@ -112,6 +322,11 @@ func (h *Handler) AddUserToGroup(w http.ResponseWriter, r *http.Request, groupID
 		return
 	}
 
+	if h.GroupService.IsBanned(groupID, member.UserID) {
+		http.Error(w, "User is banned from this group", http.StatusForbidden)
+		return
+	}
+
 	// Add the user to the group
 	groupMember := entity.GroupMember{
 		GroupID: groupID,
@@ -122,6 +337,8 @@ func (h *Handler) AddUserToGroup(w http.ResponseWriter, r *http.Request, groupID
 		return
 	}
 
+	h.WebSocketService.SendGroupEvent(groupID, entity.SystemEventJoined, actor.UserID, user.ID, fmt.Sprintf("%s was added to the group", user.Username))
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"group_id": groupID,
@@ -129,7 +346,32 @@ func (h *Handler) AddUserToGroup(w http.ResponseWriter, r *http.Request, groupID
 	})
 }
 
+// ListGroupMembers returns the active members of a group. Members of
+// private groups are only listed to other members, named by the user_id
+// query parameter; to everyone else the group does not exist, as in the
+// gRPC API.
 func (h *Handler) ListGroupMembers(w http.ResponseWriter, r *http.Request, groupID uint) {
+	var group entity.Group
+	if err := h.GroupService.DB.Select("id, visibility").First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding group", http.StatusInternalServerError)
+		return
+	}
+	if group.Visibility == entity.GroupVisibilityPrivate {
+		userID, err := queryUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := h.GroupService.GetMember(groupID, userID); err != nil {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+	}
+
 	var members []entity.GroupMember
 	if err := h.GroupService.DB.Where("group_id = ? AND deleted_at IS NULL", groupID).Find(&members).Error; err != nil {
 		http.Error(w, "Error fetching group members", http.StatusInternalServerError)
@@ -140,16 +382,19 @@ func (h *Handler) ListGroupMembers(w http.ResponseWriter, r *http.Request, group
 	json.NewEncoder(w).Encode(members)
 }
 
+// RemoveUserFromGroup removes a member on behalf of an admin who outranks
+// them. Members leave on their own through LeaveGroup.
 func (h *Handler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request, groupID uint) {
 	var member struct {
-		UserID uint `json:"user_id"`
+		UserID  uint `json:"user_id"`  // The member to remove
+		AdminID uint `json:"admin_id"` // The admin removing them
 	}
 	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if member.UserID == 0 {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	if member.UserID == 0 || member.AdminID == 0 {
+		http.Error(w, "user_id and admin_id are required", http.StatusBadRequest)
 		return
 	}
 
@@ -174,6 +419,11 @@ func (h *Handler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request, gr
 		http.Error(w, "Error finding group member", http.StatusInternalServerError)
 		return
 	}
+	actor, err := h.GroupService.GetMember(groupID, member.AdminID)
+	if err != nil || !actor.CanModerate(groupMember) {
+		http.Error(w, "Only group admins can remove members of a lower role", http.StatusForbidden)
+		return
+	}
 
 	// Soft delete the group member
 	if err := h.GroupService.DB.Delete(&groupMember).Error; err != nil {
@@ -181,8 +431,140 @@ func (h *Handler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request, gr
 		return
 	}
 
+	h.WebSocketService.SendGroupEvent(groupID, entity.SystemEventRemoved, actor.UserID, member.UserID, fmt.Sprintf("%s was removed from the group", h.actorName(member.UserID)))
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "User removed from group",
 	})
 }
+
+func (h *Handler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	groupMember, err := h.GroupService.GetMember(group.ID, req.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User is not in the group", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding group member", http.StatusInternalServerError)
+		return
+	}
+
+	// A group must keep an owner while it has members
+	if groupMember.Role == entity.GroupRoleOwner {
+		var owners, members int64
+		h.GroupService.DB.Model(&entity.GroupMember{}).Where("group_id = ? AND role = ? AND deleted_at IS NULL", group.ID, entity.GroupRoleOwner).Count(&owners)
+		h.GroupService.DB.Model(&entity.GroupMember{}).Where("group_id = ? AND deleted_at IS NULL", group.ID).Count(&members)
+		if owners == 1 && members > 1 {
+			http.Error(w, "Transfer ownership before leaving the group", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.GroupService.DB.Delete(groupMember).Error; err != nil {
+		http.Error(w, "Error leaving group", http.StatusInternalServerError)
+		return
+	}
+
+	h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventLeft, req.UserID, req.UserID, fmt.Sprintf("%s left the group", h.actorName(req.UserID)))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Left the group",
+	})
+}
+
+// ChangeMemberRole promotes or demotes a member. Admins can move members
+// between member and admin; only owners can grant or revoke ownership.
+func (h *Handler) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	memberID, err := strconv.Atoi(mux.Vars(r)["member_id"])
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		UserID uint   `json:"user_id"` // The admin making the change
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if req.Role != entity.GroupRoleOwner && req.Role != entity.GroupRoleAdmin && req.Role != entity.GroupRoleMember {
+		http.Error(w, "Role must be owner, admin or member", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	actor, err := h.GroupService.GetMember(group.ID, req.UserID)
+	if err != nil || !actor.IsAdmin() {
+		http.Error(w, "Only group admins can change roles", http.StatusForbidden)
+		return
+	}
+	target, err := h.GroupService.GetMember(group.ID, uint(memberID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User is not in the group", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding group member", http.StatusInternalServerError)
+		return
+	}
+	if (req.Role == entity.GroupRoleOwner || target.Role == entity.GroupRoleOwner) && actor.Role != entity.GroupRoleOwner {
+		http.Error(w, "Only owners can grant or revoke ownership", http.StatusForbidden)
+		return
+	}
+	if target.Role == req.Role {
+		http.Error(w, "Member already has this role", http.StatusBadRequest)
+		return
+	}
+	if target.Role == entity.GroupRoleOwner {
+		var owners int64
+		h.GroupService.DB.Model(&entity.GroupMember{}).Where("group_id = ? AND role = ? AND deleted_at IS NULL", group.ID, entity.GroupRoleOwner).Count(&owners)
+		if owners == 1 {
+			http.Error(w, "A group must have at least one owner", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.GroupService.DB.Model(target).Update("role", req.Role).Error; err != nil {
+		http.Error(w, "Error changing role", http.StatusInternalServerError)
+		return
+	}
+
+	h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventRoleChanged, req.UserID, target.UserID,
+		fmt.Sprintf("%s made %s %s", h.actorName(req.UserID), h.actorName(target.UserID), roleWithArticle(req.Role)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(target)
+}
+
+func roleWithArticle(role string) string {
+	if role == entity.GroupRoleOwner || role == entity.GroupRoleAdmin {
+		return "an " + role
+	}
+	return "a " + role
+}
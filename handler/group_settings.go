@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// loadGroup parses the group_id path variable and fetches the group,
+// writing the error response itself when it returns false.
+func (h *Handler) loadGroup(w http.ResponseWriter, r *http.Request) (*entity.Group, bool) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["group_id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var group entity.Group
+	if err := h.GroupService.DB.First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding group", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &group, true
+}
+
+// actorName returns the username used in system messages for an acting user.
+func (h *Handler) actorName(userID uint) string {
+	var user entity.User
+	if err := h.GroupService.DB.First(&user, userID).Error; err != nil {
+		return fmt.Sprintf("User %d", userID)
+	}
+	return user.Username
+}
+
+func (h *Handler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID      uint    `json:"user_id"` // The admin making the change
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		AvatarURL   *string `json:"avatar_url"`
+		Visibility  *string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil && *req.Name == "" {
+		http.Error(w, "Group name cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if req.Visibility != nil && !entity.ValidGroupVisibility(*req.Visibility) {
+		http.Error(w, "Visibility must be public, private or approval", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can update the group", http.StatusForbidden)
+		return
+	}
+
+	type announcement struct {
+		event   string
+		content string
+	}
+	updates := map[string]interface{}{}
+	var announcements []announcement
+	actor := h.actorName(req.UserID)
+	if req.Name != nil && *req.Name != group.Name {
+		updates["name"] = *req.Name
+		announcements = append(announcements, announcement{entity.SystemEventRenamed, fmt.Sprintf("%s renamed the group from %q to %q", actor, group.Name, *req.Name)})
+	}
+	if req.Description != nil && *req.Description != group.Description {
+		updates["description"] = *req.Description
+		announcements = append(announcements, announcement{entity.SystemEventUpdated, fmt.Sprintf("%s updated the group description", actor)})
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != group.AvatarURL {
+		updates["avatar_url"] = *req.AvatarURL
+		announcements = append(announcements, announcement{entity.SystemEventUpdated, fmt.Sprintf("%s changed the group avatar", actor)})
+	}
+	if req.Visibility != nil && *req.Visibility != group.Visibility {
+		updates["visibility"] = *req.Visibility
+		announcements = append(announcements, announcement{entity.SystemEventUpdated, fmt.Sprintf("%s made the group %s", actor, *req.Visibility)})
+	}
+
+	if len(updates) > 0 {
+		if err := h.GroupService.DB.Model(group).Updates(updates).Error; err != nil {
+			http.Error(w, "Error updating group", http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, a := range announcements {
+		h.WebSocketService.SendGroupEvent(group.ID, a.event, req.UserID, 0, a.content)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func (h *Handler) ArchiveGroup(w http.ResponseWriter, r *http.Request) {
+	h.setGroupArchived(w, r, true)
+}
+
+func (h *Handler) UnarchiveGroup(w http.ResponseWriter, r *http.Request) {
+	h.setGroupArchived(w, r, false)
+}
+
+func (h *Handler) setGroupArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	var req struct {
+		UserID uint `json:"user_id"` // The admin making the change
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can archive the group", http.StatusForbidden)
+		return
+	}
+	if (group.ArchivedAt != nil) == archived {
+		if archived {
+			http.Error(w, "Group is already archived", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Group is not archived", http.StatusBadRequest)
+		}
+		return
+	}
+
+	var archivedAt *time.Time
+	event := entity.SystemEventUnarchived
+	announcement := fmt.Sprintf("%s unarchived the group", h.actorName(req.UserID))
+	if archived {
+		now := time.Now().UTC()
+		archivedAt = &now
+		event = entity.SystemEventArchived
+		announcement = fmt.Sprintf("%s archived the group", h.actorName(req.UserID))
+	}
+	if err := h.GroupService.DB.Model(group).Update("archived_at", archivedAt).Error; err != nil {
+		http.Error(w, "Error updating group", http.StatusInternalServerError)
+		return
+	}
+	h.WebSocketService.SendGroupEvent(group.ID, event, req.UserID, 0, announcement)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// DeleteGroup removes a group with its memberships, invites and join requests.
+// Messages are kept unless delete_messages=true is passed.
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"` // Must be the group owner
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	deleteMessages := r.URL.Query().Get("delete_messages") == "true"
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	member, err := h.GroupService.GetMember(group.ID, req.UserID)
+	if err != nil || member.Role != entity.GroupRoleOwner {
+		http.Error(w, "Only the group owner can delete the group", http.StatusForbidden)
+		return
+	}
+
+	// Collect the members before they are removed so they can be notified
+	memberIDs, err := h.GroupService.MemberIDs(group.ID)
+	if err != nil {
+		http.Error(w, "Error fetching group members", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.GroupService.DeleteGroup(group.ID, deleteMessages)
+	if err != nil {
+		log.Printf("Error deleting group %d: %v", group.ID, err)
+		http.Error(w, "Error deleting group", http.StatusInternalServerError)
+		return
+	}
+
+	h.WebSocketService.SendToUsers(memberIDs, map[string]interface{}{
+		"event":    "group_deleted",
+		"group_id": group.ID,
+		"content":  fmt.Sprintf("%s deleted the group %q", h.actorName(req.UserID), group.Name),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Group deleted",
+		"messages_deleted": deleteMessages,
+	})
+}
@@ -1,17 +1,61 @@
 package handler
 
-import "chat_app/services"
+import (
+	"chat_app/services"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
 
 type Handler struct {
-	GroupService     *services.GroupService
-	WebSocketService *services.WebSocketService
-	AuthService      *services.AuthService
+	GroupService      *services.GroupService
+	WebSocketService  *services.WebSocketService
+	AuthService       *services.AuthService
+	MessageService    *services.MessageService
+	AdminService      *services.AdminService
+	AttachmentService *services.AttachmentService
+	WebhookService    *services.WebhookService
 }
 
-func NewHandler(authService *services.AuthService, groupService *services.GroupService, wsService *services.WebSocketService) *Handler {
+func NewHandler(authService *services.AuthService, groupService *services.GroupService, wsService *services.WebSocketService, messageService *services.MessageService, adminService *services.AdminService, attachmentService *services.AttachmentService, webhookService *services.WebhookService) *Handler {
 	return &Handler{
-		AuthService:      authService,
-		GroupService:     groupService,
-		WebSocketService: wsService,
+		AuthService:       authService,
+		GroupService:      groupService,
+		WebSocketService:  wsService,
+		MessageService:    messageService,
+		AdminService:      adminService,
+		AttachmentService: attachmentService,
+		WebhookService:    webhookService,
+	}
+}
+
+// queryUserID reads the acting user's ID from the user_id query parameter.
+func queryUserID(r *http.Request) (uint, error) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || userID <= 0 {
+		return 0, errors.New("user_id query parameter is required")
+	}
+	return uint(userID), nil
+}
+
+// parsePagination reads the page and page_size query parameters,
+// falling back to the first page of defaultPageSize items.
+func parsePagination(r *http.Request) (page, pageSize int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err = strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
 	}
+	return page, pageSize
 }
@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"bytes"
+	"chat_app/entity"
+	"chat_app/services"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Bot names become part of the bot's username, so they stay mentionable.
+var botNamePattern = regexp.MustCompile(`^[\w.-]{1,32}$`)
+
+// maxHookAttachments caps the files of one incoming webhook post.
+const maxHookAttachments = 10
+
+type incomingWebhookView struct {
+	entity.IncomingWebhook
+	URL string `json:"url,omitempty"` // Only returned on creation
+}
+
+func (h *Handler) HandleIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.CreateIncomingWebhook(w, r)
+	case http.MethodGet:
+		h.ListIncomingWebhooks(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CreateIncomingWebhook gives a group a secret URL that posts as a new bot
+// user. The URL is only returned here. Interactions with the bot's messages
+// are posted to the optional callback_url, signed with the URL's token.
+func (h *Handler) CreateIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID      uint   `json:"user_id"` // The admin creating the webhook
+		Name        string `json:"name"`
+		CallbackURL string `json:"callback_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if !botNamePattern.MatchString(req.Name) {
+		http.Error(w, "Name must be 1 to 32 letters, digits, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+	if req.CallbackURL != "" {
+		target, err := url.Parse(req.CallbackURL)
+		if err != nil || target.Scheme != "https" || target.Host == "" {
+			http.Error(w, "Callback URL must be an absolute https URL", http.StatusBadRequest)
+			return
+		}
+		// Hostnames are checked again whenever the callback is dialled
+		if ip := net.ParseIP(target.Hostname()); ip != nil && !services.IsPublicIP(ip) {
+			http.Error(w, "Callback URL must point to a public address", http.StatusBadRequest)
+			return
+		}
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can create webhooks", http.StatusForbidden)
+		return
+	}
+	if group.ArchivedAt != nil {
+		http.Error(w, "Group is archived", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		log.Printf("Error generating webhook token: %v", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+	webhook, bot, err := h.WebhookService.CreateIncoming(group, req.Name, token, req.CallbackURL, req.UserID)
+	if err != nil {
+		log.Printf("Error creating incoming webhook for group %d: %v", group.ID, err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d created incoming webhook %d for group %d", req.UserID, webhook.ID, group.ID)
+
+	h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventJoined, req.UserID, bot.ID, fmt.Sprintf("%s added the webhook bot %s", h.actorName(req.UserID), bot.Username))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(incomingWebhookView{
+		IncomingWebhook: *webhook,
+		URL:             "/hooks/" + token,
+	})
+}
+
+func (h *Handler) ListIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, userID) {
+		http.Error(w, "Only group admins can list webhooks", http.StatusForbidden)
+		return
+	}
+
+	var webhooks []entity.IncomingWebhook
+	if err := h.WebhookService.DB.Where("group_id = ? AND revoked_at IS NULL", group.ID).Find(&webhooks).Error; err != nil {
+		http.Error(w, "Error fetching webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// RevokeIncomingWebhook disables a webhook's URL and removes its bot from
+// the group.
+func (h *Handler) RevokeIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"` // The admin revoking the webhook
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	webhookID, err := strconv.Atoi(mux.Vars(r)["webhook_id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can revoke webhooks", http.StatusForbidden)
+		return
+	}
+
+	var webhook entity.IncomingWebhook
+	if err := h.WebhookService.DB.Where("id = ? AND group_id = ?", webhookID, group.ID).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding webhook", http.StatusInternalServerError)
+		return
+	}
+	if webhook.RevokedAt != nil {
+		http.Error(w, "Webhook is already revoked", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.WebhookService.RevokeIncoming(&webhook); err != nil {
+		log.Printf("Error revoking incoming webhook %d: %v", webhook.ID, err)
+		http.Error(w, "Error revoking webhook", http.StatusInternalServerError)
+		return
+	}
+	h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventRemoved, req.UserID, webhook.BotUserID, fmt.Sprintf("%s removed the webhook bot %s", h.actorName(req.UserID), h.actorName(webhook.BotUserID)))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Webhook revoked",
+	})
+}
+
+// PostIncomingWebhook posts a message into the webhook's group as its bot.
+// The payload is {"text", "format", "blocks", "attachments": [{"file_name",
+// "data"}]} with base64 file data; blocks make the message interactive. The message goes through the Broadcast pipeline,
+// so archived groups and mutes apply as for any member. Those checks run
+// before the files are stored, and files of a rejected post are deleted.
+func (h *Handler) PostIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook entity.IncomingWebhook
+	if err := h.WebhookService.DB.Where("token = ?", mux.Vars(r)["token"]).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding webhook", http.StatusInternalServerError)
+		return
+	}
+	if webhook.RevokedAt != nil {
+		http.Error(w, "Webhook has been revoked", http.StatusGone)
+		return
+	}
+	if ok, wait := h.WebhookService.AllowIncoming(webhook.ID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, fmt.Sprintf("Rate limit of %d messages per minute exceeded", services.IncomingWebhookRateLimit), http.StatusTooManyRequests)
+		return
+	}
+
+	// Base64 grows files by a third
+	r.Body = http.MaxBytesReader(w, r.Body, h.AttachmentService.Config.MaxUploadBytes*4/3+multipartOverhead)
+	var payload struct {
+		Text        string        `json:"text"`
+		Format      string        `json:"format"`
+		Blocks      entity.Blocks `json:"blocks"`
+		Attachments []struct {
+			FileName string `json:"file_name"`
+			Data     string `json:"data"`
+		} `json:"attachments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Payload is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload.Text == "" && len(payload.Attachments) == 0 {
+		http.Error(w, "text or attachments are required", http.StatusBadRequest)
+		return
+	}
+	if err := payload.Blocks.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Format != "" && payload.Format != entity.MessageFormatPlain && payload.Format != entity.MessageFormatMarkdown {
+		http.Error(w, "Format must be plain or markdown", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Attachments) > maxHookAttachments {
+		http.Error(w, fmt.Sprintf("At most %d attachments are allowed", maxHookAttachments), http.StatusBadRequest)
+		return
+	}
+
+	files := make([][]byte, len(payload.Attachments))
+	for i, file := range payload.Attachments {
+		data, err := base64.StdEncoding.DecodeString(file.Data)
+		if err != nil || file.FileName == "" {
+			http.Error(w, "Attachments need a file_name and base64 data", http.StatusBadRequest)
+			return
+		}
+		files[i] = data
+	}
+
+	msg := entity.Message{
+		SenderID: webhook.BotUserID,
+		GroupID:  webhook.GroupID,
+		Content:  payload.Text,
+		Format:   payload.Format,
+		Blocks:   payload.Blocks,
+	}
+	if err := h.WebSocketService.CheckPostable(msg); err != nil {
+		if errors.Is(err, services.ErrPostCheckFailed) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var uploaded []entity.Attachment
+	discardUploads := func() {
+		for i := range uploaded {
+			if err := h.AttachmentService.Delete(context.Background(), &uploaded[i]); err != nil {
+				log.Printf("Error deleting attachment %d of a rejected webhook post: %v", uploaded[i].ID, err)
+			}
+		}
+	}
+	for i, file := range payload.Attachments {
+		attachment, err := h.AttachmentService.Upload(r.Context(), webhook.BotUserID, file.FileName, int64(len(files[i])), bytes.NewReader(files[i]))
+		if err != nil {
+			discardUploads()
+			switch {
+			case errors.Is(err, services.ErrAttachmentTooLarge):
+				http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			case errors.Is(err, services.ErrQuotaExceeded):
+				http.Error(w, "Storage quota exceeded", http.StatusForbidden)
+			case errors.Is(err, services.ErrImageMalformed):
+				http.Error(w, "Image could not be read", http.StatusBadRequest)
+			default:
+				log.Printf("Error uploading attachment for webhook %d: %v", webhook.ID, err)
+				http.Error(w, "Error uploading file", http.StatusInternalServerError)
+			}
+			return
+		}
+		uploaded = append(uploaded, *attachment)
+		msg.AttachmentIDs = append(msg.AttachmentIDs, attachment.ID)
+	}
+
+	if _, err := h.WebSocketService.SubmitMessage(webhook.BotUserID, msg); err != nil {
+		discardUploads()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Incoming webhook %d posted to group %d", webhook.ID, webhook.GroupID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Message queued",
+	})
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInviteUnusable = errors.New("invite is expired, revoked or used up")
+var errAlreadyMember = errors.New("user is already in the group")
+var errBanned = errors.New("user is banned from the group")
+
+func (h *Handler) HandleGroupInvites(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupIDStr := vars["group_id"]
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.CreateInvite(w, r, uint(groupID))
+	case http.MethodGet:
+		h.ListInvites(w, r, uint(groupID))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request, groupID uint) {
+	var req struct {
+		UserID    uint       `json:"user_id"` // The admin creating the invite
+		ExpiresAt *time.Time `json:"expires_at"`
+		MaxUses   int        `json:"max_uses"`
+		Role      string     `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now().UTC()) {
+		http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+	if req.MaxUses < 0 {
+		http.Error(w, "max_uses cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = entity.GroupRoleMember
+	}
+	if req.Role != entity.GroupRoleMember && req.Role != entity.GroupRoleAdmin {
+		http.Error(w, "Role must be member or admin", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the group exists
+	var group entity.Group
+	if err := h.GroupService.DB.First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding group", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.GroupService.IsAdmin(groupID, req.UserID) {
+		http.Error(w, "Only group admins can create invites", http.StatusForbidden)
+		return
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		log.Printf("Error generating invite token: %v", err)
+		http.Error(w, "Error creating invite", http.StatusInternalServerError)
+		return
+	}
+
+	invite := entity.GroupInvite{
+		GroupID:   groupID,
+		Token:     token,
+		CreatedBy: req.UserID,
+		Role:      req.Role,
+		ExpiresAt: req.ExpiresAt,
+		MaxUses:   req.MaxUses,
+	}
+	if err := h.GroupService.DB.Create(&invite).Error; err != nil {
+		http.Error(w, "Error creating invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+func (h *Handler) ListInvites(w http.ResponseWriter, r *http.Request, groupID uint) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.GroupService.IsAdmin(groupID, userID) {
+		http.Error(w, "Only group admins can list invites", http.StatusForbidden)
+		return
+	}
+
+	var invites []entity.GroupInvite
+	if err := h.GroupService.DB.Where("group_id = ? AND revoked_at IS NULL", groupID).Find(&invites).Error; err != nil {
+		http.Error(w, "Error fetching invites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+func (h *Handler) JoinWithInvite(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user exists
+	var user entity.User
+	if err := h.GroupService.DB.First(&user, req.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return
+	}
+
+	var invite entity.GroupInvite
+	var groupMember entity.GroupMember
+	err := h.GroupService.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the invite so concurrent joins cannot exceed max_uses
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token = ?", token).First(&invite).Error; err != nil {
+			return err
+		}
+		if !invite.Usable(time.Now().UTC()) {
+			return errInviteUnusable
+		}
+
+		var existingMember entity.GroupMember
+		if err := tx.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", invite.GroupID, req.UserID).First(&existingMember).Error; err == nil {
+			return errAlreadyMember
+		}
+		var ban entity.GroupBan
+		if err := tx.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", invite.GroupID, req.UserID).First(&ban).Error; err == nil {
+			return errBanned
+		}
+
+		groupMember = entity.GroupMember{
+			GroupID: invite.GroupID,
+			UserID:  req.UserID,
+			Role:    invite.Role,
+		}
+		if err := tx.Create(&groupMember).Error; err != nil {
+			return err
+		}
+		return tx.Model(&invite).Update("uses", gorm.Expr("uses + 1")).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			http.Error(w, "Invite not found", http.StatusNotFound)
+		case errors.Is(err, errInviteUnusable):
+			http.Error(w, "Invite is no longer valid", http.StatusGone)
+		case errors.Is(err, errAlreadyMember):
+			http.Error(w, "User is already in the group", http.StatusBadRequest)
+		case errors.Is(err, errBanned):
+			http.Error(w, "User is banned from this group", http.StatusForbidden)
+		default:
+			log.Printf("Error joining group with invite: %v", err)
+			http.Error(w, "Error joining group", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.WebSocketService.SendGroupEvent(invite.GroupID, entity.SystemEventJoined, user.ID, user.ID, fmt.Sprintf("%s joined the group via invite link", user.Username))
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group_id": invite.GroupID,
+		"user_id":  req.UserID,
+		"role":     groupMember.Role,
+	})
+}
+
+func (h *Handler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	var req struct {
+		UserID uint `json:"user_id"` // The admin revoking the invite
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var invite entity.GroupInvite
+	if err := h.GroupService.DB.Where("token = ?", token).First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Invite not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding invite", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.GroupService.IsAdmin(invite.GroupID, req.UserID) {
+		http.Error(w, "Only group admins can revoke invites", http.StatusForbidden)
+		return
+	}
+	if invite.RevokedAt != nil {
+		http.Error(w, "Invite is already revoked", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.GroupService.DB.Model(&invite).Update("revoked_at", time.Now().UTC()).Error; err != nil {
+		http.Error(w, "Error revoking invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Invite revoked",
+	})
+}
+
+// newInviteToken returns a random URL-safe token for invite links.
+func newInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
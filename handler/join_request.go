@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errJoinRequestReviewed = errors.New("join request has already been reviewed")
+
+func (h *Handler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["group_id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.GroupService.IsAdmin(uint(groupID), userID) {
+		http.Error(w, "Only group admins can view join requests", http.StatusForbidden)
+		return
+	}
+
+	var requests []entity.GroupJoinRequest
+	if err := h.GroupService.DB.Where("group_id = ? AND status = ?", groupID, entity.JoinRequestPending).Order("created_at").Find(&requests).Error; err != nil {
+		http.Error(w, "Error fetching join requests", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+func (h *Handler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	h.reviewJoinRequest(w, r, entity.JoinRequestApproved)
+}
+
+func (h *Handler) RejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	h.reviewJoinRequest(w, r, entity.JoinRequestRejected)
+}
+
+func (h *Handler) reviewJoinRequest(w http.ResponseWriter, r *http.Request, status string) {
+	vars := mux.Vars(r)
+	groupID, err := strconv.Atoi(vars["group_id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	requestID, err := strconv.Atoi(vars["request_id"])
+	if err != nil {
+		http.Error(w, "Invalid request ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		UserID uint `json:"user_id"` // The admin reviewing the request
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if !h.GroupService.IsAdmin(uint(groupID), req.UserID) {
+		http.Error(w, "Only group admins can review join requests", http.StatusForbidden)
+		return
+	}
+
+	var joinRequest entity.GroupJoinRequest
+	err = h.GroupService.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND group_id = ?", requestID, groupID).First(&joinRequest).Error; err != nil {
+			return err
+		}
+		if joinRequest.Status != entity.JoinRequestPending {
+			return errJoinRequestReviewed
+		}
+
+		now := time.Now().UTC()
+		joinRequest.Status = status
+		joinRequest.ReviewedBy = req.UserID
+		joinRequest.ReviewedAt = &now
+		if err := tx.Save(&joinRequest).Error; err != nil {
+			return err
+		}
+		if status != entity.JoinRequestApproved {
+			return nil
+		}
+
+		var ban entity.GroupBan
+		if err := tx.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", groupID, joinRequest.UserID).First(&ban).Error; err == nil {
+			return errBanned
+		}
+
+		// The user may have joined through an invite in the meantime
+		var existingMember entity.GroupMember
+		if err := tx.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", groupID, joinRequest.UserID).First(&existingMember).Error; err == nil {
+			return nil
+		}
+		return tx.Create(&entity.GroupMember{
+			GroupID: uint(groupID),
+			UserID:  joinRequest.UserID,
+		}).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			http.Error(w, "Join request not found", http.StatusNotFound)
+		case errors.Is(err, errJoinRequestReviewed):
+			http.Error(w, "Join request has already been reviewed", http.StatusBadRequest)
+		case errors.Is(err, errBanned):
+			http.Error(w, "User is banned from this group", http.StatusForbidden)
+		default:
+			log.Printf("Error reviewing join request %d: %v", requestID, err)
+			http.Error(w, "Error reviewing join request", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.WebSocketService.SendToUsers([]uint{joinRequest.UserID}, map[string]interface{}{
+		"event":      "join_request_" + status,
+		"group_id":   groupID,
+		"request_id": joinRequest.ID,
+	})
+	if status == entity.JoinRequestApproved {
+		var user entity.User
+		if err := h.GroupService.DB.First(&user, joinRequest.UserID).Error; err == nil {
+			h.WebSocketService.SendGroupEvent(uint(groupID), entity.SystemEventJoined, req.UserID, user.ID, fmt.Sprintf("%s joined the group", user.Username))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(joinRequest)
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type mentionView struct {
+	entity.Mention
+	Content   string `json:"content"`
+	GroupName string `json:"group_name"`
+}
+
+// ListMentions lists the messages the caller was mentioned in, newest first,
+// limited to groups they are still a member of.
+func (h *Handler) ListMentions(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, pageSize := parsePagination(r)
+
+	query := h.MessageService.DB.Table("mentions").
+		Joins("JOIN messages ON messages.id = mentions.message_id AND messages.deleted_at IS NULL").
+		Joins("JOIN groups ON groups.id = mentions.group_id AND groups.deleted_at IS NULL").
+		Joins("JOIN group_members ON group_members.group_id = mentions.group_id AND group_members.user_id = mentions.user_id AND group_members.deleted_at IS NULL").
+		Where("mentions.user_id = ?", userID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error fetching mentions", http.StatusInternalServerError)
+		return
+	}
+	mentions := []mentionView{}
+	if err := query.Select("mentions.*, messages.content, groups.name AS group_name").
+		Order("mentions.id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&mentions).Error; err != nil {
+		http.Error(w, "Error fetching mentions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mentions":  mentions,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// SetGroupNotifications stores the caller's notification preference for a
+// group. Muted groups still produce mention events.
+func (h *Handler) SetGroupNotifications(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"`
+		Muted  bool `json:"muted"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	member, err := h.GroupService.GetMember(group.ID, req.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User is not in the group", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding group member", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.GroupService.DB.Model(member).Update("notifications_muted", req.Muted).Error; err != nil {
+		http.Error(w, "Error updating notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group_id": group.ID,
+		"muted":    req.Muted,
+	})
+}
@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// loadModerationTarget checks that the actor may moderate the target member
+// of the group, writing the error response itself when it returns false.
+func (h *Handler) loadModerationTarget(w http.ResponseWriter, groupID, actorID, targetID uint) (*entity.GroupMember, bool) {
+	actor, err := h.GroupService.GetMember(groupID, actorID)
+	if err != nil || !actor.IsAdmin() {
+		http.Error(w, "Only group admins can moderate members", http.StatusForbidden)
+		return nil, false
+	}
+	target, err := h.GroupService.GetMember(groupID, targetID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User is not in the group", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding group member", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !actor.CanModerate(*target) {
+		http.Error(w, "You cannot moderate this member", http.StatusForbidden)
+		return nil, false
+	}
+	return target, true
+}
+
+// loadBanTarget checks that the actor may ban the user from the group. Users
+// who are not members can be banned too, so leaving does not dodge a ban;
+// the returned membership is nil for them.
+func (h *Handler) loadBanTarget(w http.ResponseWriter, groupID, actorID, targetID uint) (*entity.GroupMember, bool) {
+	actor, err := h.GroupService.GetMember(groupID, actorID)
+	if err != nil || !actor.IsAdmin() {
+		http.Error(w, "Only group admins can moderate members", http.StatusForbidden)
+		return nil, false
+	}
+	var user entity.User
+	if err := h.GroupService.DB.First(&user, targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding user", http.StatusInternalServerError)
+		return nil, false
+	}
+	target, err := h.GroupService.GetMember(groupID, targetID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, true
+	}
+	if err != nil {
+		http.Error(w, "Error finding group member", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !actor.CanModerate(*target) {
+		http.Error(w, "You cannot moderate this member", http.StatusForbidden)
+		return nil, false
+	}
+	return target, true
+}
+
+func (h *Handler) MuteMember(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   uint `json:"user_id"`   // The admin muting the member
+		MemberID uint `json:"member_id"` // The member to mute
+		Duration int  `json:"duration"`  // Seconds
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 || req.MemberID == 0 {
+		http.Error(w, "user_id and member_id are required", http.StatusBadRequest)
+		return
+	}
+	if req.Duration <= 0 {
+		http.Error(w, "Duration must be a positive number of seconds", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	target, ok := h.loadModerationTarget(w, group.ID, req.UserID, req.MemberID)
+	if !ok {
+		return
+	}
+
+	mutedUntil := time.Now().UTC().Add(time.Duration(req.Duration) * time.Second)
+	if err := h.GroupService.DB.Model(target).Update("muted_until", mutedUntil).Error; err != nil {
+		http.Error(w, "Error muting member", http.StatusInternalServerError)
+		return
+	}
+	h.GroupService.LogModeration(group.ID, req.UserID, entity.ModerationMute, req.MemberID, fmt.Sprintf("muted until %s", mutedUntil.Format(time.RFC3339)))
+
+	h.WebSocketService.SendToUsers([]uint{req.MemberID}, map[string]interface{}{
+		"event":       "muted",
+		"group_id":    group.ID,
+		"muted_until": mutedUntil,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(target)
+}
+
+func (h *Handler) UnmuteMember(w http.ResponseWriter, r *http.Request) {
+	memberID, err := strconv.Atoi(mux.Vars(r)["member_id"])
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		UserID uint `json:"user_id"` // The admin unmuting the member
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	target, ok := h.loadModerationTarget(w, group.ID, req.UserID, uint(memberID))
+	if !ok {
+		return
+	}
+	if !target.IsMuted(time.Now().UTC()) {
+		http.Error(w, "Member is not muted", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.GroupService.DB.Model(target).Update("muted_until", nil).Error; err != nil {
+		http.Error(w, "Error unmuting member", http.StatusInternalServerError)
+		return
+	}
+	h.GroupService.LogModeration(group.ID, req.UserID, entity.ModerationUnmute, target.UserID, "")
+
+	h.WebSocketService.SendToUsers([]uint{target.UserID}, map[string]interface{}{
+		"event":    "unmuted",
+		"group_id": group.ID,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Member unmuted",
+	})
+}
+
+func (h *Handler) HandleGroupBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.BanMember(w, r)
+	case http.MethodGet:
+		h.ListBans(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// BanMember removes a member from the group and keeps them from re-joining.
+func (h *Handler) BanMember(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   uint   `json:"user_id"`   // The admin banning the member
+		MemberID uint   `json:"member_id"` // The member to ban
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 || req.MemberID == 0 {
+		http.Error(w, "user_id and member_id are required", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	target, ok := h.loadBanTarget(w, group.ID, req.UserID, req.MemberID)
+	if !ok {
+		return
+	}
+	if h.GroupService.IsBanned(group.ID, req.MemberID) {
+		http.Error(w, "User is already banned", http.StatusBadRequest)
+		return
+	}
+
+	ban := entity.GroupBan{
+		GroupID:  group.ID,
+		UserID:   req.MemberID,
+		BannedBy: req.UserID,
+		Reason:   req.Reason,
+	}
+	err := h.GroupService.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ban).Error; err != nil {
+			return err
+		}
+		// Pending join requests would otherwise let the user back in
+		if err := tx.Model(&entity.GroupJoinRequest{}).
+			Where("group_id = ? AND user_id = ? AND status = ?", group.ID, req.MemberID, entity.JoinRequestPending).
+			Update("status", entity.JoinRequestRejected).Error; err != nil {
+			return err
+		}
+		if target == nil {
+			return nil
+		}
+		return tx.Delete(target).Error
+	})
+	if err != nil {
+		log.Printf("Error banning user %d from group %d: %v", req.MemberID, group.ID, err)
+		http.Error(w, "Error banning member", http.StatusInternalServerError)
+		return
+	}
+	h.GroupService.LogModeration(group.ID, req.UserID, entity.ModerationBan, req.MemberID, req.Reason)
+
+	if target != nil {
+		h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventRemoved, req.UserID, req.MemberID,
+			fmt.Sprintf("%s was banned from the group by %s", h.actorName(req.MemberID), h.actorName(req.UserID)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+}
+
+func (h *Handler) ListBans(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, userID) {
+		http.Error(w, "Only group admins can view bans", http.StatusForbidden)
+		return
+	}
+
+	var bans []entity.GroupBan
+	if err := h.GroupService.DB.Where("group_id = ? AND deleted_at IS NULL", group.ID).Find(&bans).Error; err != nil {
+		http.Error(w, "Error fetching bans", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+func (h *Handler) UnbanMember(w http.ResponseWriter, r *http.Request) {
+	memberID, err := strconv.Atoi(mux.Vars(r)["member_id"])
+	if err != nil {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		UserID uint `json:"user_id"` // The admin lifting the ban
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can lift bans", http.StatusForbidden)
+		return
+	}
+
+	result := h.GroupService.DB.Where("group_id = ? AND user_id = ?", group.ID, memberID).Delete(&entity.GroupBan{})
+	if result.Error != nil {
+		http.Error(w, "Error lifting ban", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "User is not banned", http.StatusNotFound)
+		return
+	}
+	h.GroupService.LogModeration(group.ID, req.UserID, entity.ModerationUnban, uint(memberID), "")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Ban lifted",
+	})
+}
+
+func (h *Handler) SetSlowMode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID  uint `json:"user_id"` // The admin changing slow mode
+		Seconds int  `json:"seconds"` // 0 disables slow mode
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if req.Seconds < 0 {
+		http.Error(w, "Seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, req.UserID) {
+		http.Error(w, "Only group admins can change slow mode", http.StatusForbidden)
+		return
+	}
+
+	if err := h.GroupService.DB.Model(group).Update("slow_mode", req.Seconds).Error; err != nil {
+		http.Error(w, "Error updating slow mode", http.StatusInternalServerError)
+		return
+	}
+	h.GroupService.LogModeration(group.ID, req.UserID, entity.ModerationSlowMode, 0, fmt.Sprintf("%d seconds", req.Seconds))
+
+	announcement := fmt.Sprintf("%s turned off slow mode", h.actorName(req.UserID))
+	if req.Seconds > 0 {
+		announcement = fmt.Sprintf("%s enabled slow mode: one message every %d seconds", h.actorName(req.UserID), req.Seconds)
+	}
+	h.WebSocketService.SendGroupEvent(group.ID, entity.SystemEventUpdated, req.UserID, 0, announcement)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func (h *Handler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := parsePagination(r)
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	if !h.GroupService.IsAdmin(group.ID, userID) {
+		http.Error(w, "Only group admins can view the audit log", http.StatusForbidden)
+		return
+	}
+
+	var entries []entity.GroupAuditLog
+	if err := h.GroupService.DB.Where("group_id = ?", group.ID).
+		Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&entries).Error; err != nil {
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxPinsPerConversation keeps pinned lists short enough to be useful.
+const maxPinsPerConversation = 50
+
+type pinnedView struct {
+	entity.Message
+	PinnedAt time.Time `json:"pinned_at"`
+	PinnedBy uint      `json:"pinned_by"`
+}
+
+type starredView struct {
+	entity.Message
+	StarredAt time.Time `json:"starred_at"`
+}
+
+// decodeActingUser reads the {"user_id": ...} body used by simple actions.
+func decodeActingUser(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return 0, false
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+	return req.UserID, true
+}
+
+// canPin reports whether the user may pin or unpin messages in the
+// message's conversation: group admins, or either direct participant.
+func (h *Handler) canPin(userID uint, msg *entity.Message) bool {
+	if msg.GroupID != 0 {
+		return h.GroupService.IsAdmin(msg.GroupID, userID)
+	}
+	return msg.ReceiverID != 0 && (msg.SenderID == userID || msg.ReceiverID == userID)
+}
+
+func (h *Handler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := decodeActingUser(w, r)
+	if !ok {
+		return
+	}
+	msg, ok := h.loadAccessibleMessage(w, r, userID)
+	if !ok {
+		return
+	}
+	if msg.Kind == entity.MessageKindSystem {
+		http.Error(w, "System messages cannot be pinned", http.StatusBadRequest)
+		return
+	}
+	if !h.canPin(userID, msg) {
+		http.Error(w, "Only group admins can pin messages", http.StatusForbidden)
+		return
+	}
+
+	if msg.ConversationID == 0 {
+		http.Error(w, "Message has not been sent yet", http.StatusBadRequest)
+		return
+	}
+	pin := entity.PinnedMessage{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		PinnedBy:       userID,
+	}
+
+	var existing entity.PinnedMessage
+	if err := h.MessageService.DB.Where("message_id = ?", msg.ID).First(&existing).Error; err == nil {
+		http.Error(w, "Message is already pinned", http.StatusBadRequest)
+		return
+	}
+	var count int64
+	h.MessageService.DB.Model(&entity.PinnedMessage{}).
+		Where("conversation_id = ?", pin.ConversationID).
+		Count(&count)
+	if count >= maxPinsPerConversation {
+		http.Error(w, "Too many pinned messages in this conversation", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.MessageService.DB.Create(&pin).Error; err != nil {
+		http.Error(w, "Error pinning message", http.StatusInternalServerError)
+		return
+	}
+	h.notifyPin(msg, "message_pinned", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pin)
+}
+
+func (h *Handler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := decodeActingUser(w, r)
+	if !ok {
+		return
+	}
+	msg, ok := h.loadAccessibleMessage(w, r, userID)
+	if !ok {
+		return
+	}
+	if !h.canPin(userID, msg) {
+		http.Error(w, "Only group admins can unpin messages", http.StatusForbidden)
+		return
+	}
+
+	result := h.MessageService.DB.Where("message_id = ?", msg.ID).Delete(&entity.PinnedMessage{})
+	if result.Error != nil {
+		http.Error(w, "Error unpinning message", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Message is not pinned", http.StatusNotFound)
+		return
+	}
+	h.notifyPin(msg, "message_unpinned", userID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Message unpinned",
+	})
+}
+
+func (h *Handler) notifyPin(msg *entity.Message, event string, userID uint) {
+	audience, err := h.MessageService.Audience(msg)
+	if err != nil {
+		return
+	}
+	h.WebSocketService.SendToUsers(audience, map[string]interface{}{
+		"event":       event,
+		"message_id":  msg.ID,
+		"group_id":    msg.GroupID,
+		"receiver_id": msg.ReceiverID,
+		"sender_id":   msg.SenderID,
+		"user_id":     userID,
+	})
+}
+
+// ListPins lists the pinned messages of a group (group_id) or of the
+// caller's direct conversation with another user (peer_id).
+func (h *Handler) ListPins(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupID, err := optionalUintParam(r, "group_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	peerID, err := optionalUintParam(r, "peer_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (groupID == 0) == (peerID == 0) {
+		http.Error(w, "Exactly one of group_id or peer_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if groupID != 0 {
+		if _, err := h.GroupService.GetMember(groupID, userID); err != nil {
+			http.Error(w, "You are not a member of this group", http.StatusForbidden)
+			return
+		}
+	}
+	conversation, err := h.MessageService.FindConversation(userID, groupID, peerID)
+	if err != nil {
+		http.Error(w, "Error fetching pinned messages", http.StatusInternalServerError)
+		return
+	}
+	pins := []pinnedView{}
+	if conversation == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pins)
+		return
+	}
+
+	if err := h.MessageService.DB.Table("pinned_messages").
+		Joins("JOIN messages ON messages.id = pinned_messages.message_id AND messages.deleted_at IS NULL").
+		Where("pinned_messages.conversation_id = ?", conversation.ID).
+		Select("messages.*, pinned_messages.created_at AS pinned_at, pinned_messages.pinned_by").
+		Order("pinned_messages.id DESC").
+		Scan(&pins).Error; err != nil {
+		http.Error(w, "Error fetching pinned messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pins)
+}
+
+func (h *Handler) StarMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := decodeActingUser(w, r)
+	if !ok {
+		return
+	}
+	msg, ok := h.loadAccessibleMessage(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var existing entity.StarredMessage
+	if err := h.MessageService.DB.Where("user_id = ? AND message_id = ?", userID, msg.ID).First(&existing).Error; err == nil {
+		http.Error(w, "Message is already starred", http.StatusBadRequest)
+		return
+	}
+	star := entity.StarredMessage{UserID: userID, MessageID: msg.ID}
+	if err := h.MessageService.DB.Create(&star).Error; err != nil {
+		http.Error(w, "Error starring message", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(star)
+}
+
+func (h *Handler) UnstarMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := decodeActingUser(w, r)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.Atoi(mux.Vars(r)["message_id"])
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	// No access check, so users can always clean up stars on messages they
+	// have since lost access to
+	result := h.MessageService.DB.Where("user_id = ? AND message_id = ?", userID, messageID).Delete(&entity.StarredMessage{})
+	if result.Error != nil {
+		http.Error(w, "Error unstarring message", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Message is not starred", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Message unstarred",
+	})
+}
+
+// ListStarred lists the caller's saved messages, newest first. Messages that
+// were deleted or that the caller can no longer access are left out.
+func (h *Handler) ListStarred(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, pageSize := parsePagination(r)
+
+	query := h.MessageService.DB.Table("starred_messages").
+		Joins("JOIN messages ON messages.id = starred_messages.message_id AND messages.deleted_at IS NULL").
+		Where("starred_messages.user_id = ?", userID).
+		Scopes(h.MessageService.VisibleTo(userID)).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error fetching starred messages", http.StatusInternalServerError)
+		return
+	}
+	stars := []starredView{}
+	if err := query.Select("messages.*, starred_messages.created_at AS starred_at").
+		Order("starred_messages.id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&stars).Error; err != nil {
+		http.Error(w, "Error fetching starred messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages":  stars,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// loadAccessibleMessage parses the message_id path variable and fetches the
+// message if the user can see it, writing the error response itself when it
+// returns false.
+func (h *Handler) loadAccessibleMessage(w http.ResponseWriter, r *http.Request, userID uint) (*entity.Message, bool) {
+	messageID, err := strconv.Atoi(mux.Vars(r)["message_id"])
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var msg entity.Message
+	if err := h.MessageService.DB.First(&msg, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding message", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !h.MessageService.CanAccess(userID, &msg) {
+		// Do not reveal that the message exists
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &msg, true
+}
+
+func (h *Handler) HandleReactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.AddReaction(w, r)
+	case http.MethodGet:
+		h.ListReactions(w, r)
+	case http.MethodDelete:
+		h.RemoveReaction(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type reactionRequest struct {
+	UserID uint   `json:"user_id"`
+	Emoji  string `json:"emoji"`
+}
+
+func decodeReactionRequest(w http.ResponseWriter, r *http.Request) (*reactionRequest, bool) {
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if req.UserID == 0 || req.Emoji == "" {
+		http.Error(w, "user_id and emoji are required", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.Emoji) > 32 {
+		http.Error(w, "Emoji is too long", http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeReactionRequest(w, r)
+	if !ok {
+		return
+	}
+	msg, ok := h.loadAccessibleMessage(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	if msg.GroupID != 0 {
+		var group entity.Group
+		if err := h.GroupService.DB.First(&group, msg.GroupID).Error; err == nil && group.ArchivedAt != nil {
+			http.Error(w, "This group is archived", http.StatusForbidden)
+			return
+		}
+	}
+
+	reaction := entity.MessageReaction{
+		MessageID: msg.ID,
+		UserID:    req.UserID,
+		Emoji:     req.Emoji,
+	}
+	var existing entity.MessageReaction
+	if err := h.MessageService.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", msg.ID, req.UserID, req.Emoji).First(&existing).Error; err == nil {
+		http.Error(w, "Reaction already exists", http.StatusBadRequest)
+		return
+	}
+	if err := h.MessageService.DB.Create(&reaction).Error; err != nil {
+		http.Error(w, "Error adding reaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.WebSocketService.NotifyReaction(msg, "reaction_added", reaction)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reaction)
+}
+
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeReactionRequest(w, r)
+	if !ok {
+		return
+	}
+	msg, ok := h.loadAccessibleMessage(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	result := h.MessageService.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", msg.ID, req.UserID, req.Emoji).Delete(&entity.MessageReaction{})
+	if result.Error != nil {
+		http.Error(w, "Error removing reaction", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Reaction not found", http.StatusNotFound)
+		return
+	}
+
+	h.WebSocketService.NotifyReaction(msg, "reaction_removed", entity.MessageReaction{MessageID: msg.ID, UserID: req.UserID, Emoji: req.Emoji})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Reaction removed",
+	})
+}
+
+// ListReactions returns the reaction counts for a message, grouped by emoji.
+func (h *Handler) ListReactions(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, ok := h.loadAccessibleMessage(w, r, userID)
+	if !ok {
+		return
+	}
+
+	counts, err := h.MessageService.ReactionCounts(msg.ID)
+	if err != nil {
+		http.Error(w, "Error fetching reactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
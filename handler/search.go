@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"chat_app/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchMessages runs a full-text search over the caller's visible history.
+// Filters: sender_id, group_id, peer_id (direct messages with that user),
+// and from/to as RFC 3339 timestamps or YYYY-MM-DD dates.
+func (h *Handler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "q query parameter is required", http.StatusBadRequest)
+		return
+	}
+	page, pageSize := parsePagination(r)
+
+	params := services.SearchParams{
+		UserID:   userID,
+		Query:    q,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for name, dest := range map[string]*uint{
+		"sender_id": &params.SenderID,
+		"group_id":  &params.GroupID,
+		"peer_id":   &params.PeerID,
+	} {
+		if *dest, err = optionalUintParam(r, name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if params.From, err = optionalTimeParam(r, "from"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.To, err = optionalTimeParam(r, "to"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, total, err := h.MessageService.Search(params)
+	if err != nil {
+		log.Printf("Error searching messages for user %d: %v", userID, err)
+		http.Error(w, "Error searching messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":   results,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// optionalUintParam reads a positive integer query parameter, returning 0 if absent.
+func optionalUintParam(r *http.Request, name string) (uint, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return uint(n), nil
+}
+
+// optionalTimeParam reads an RFC 3339 timestamp or a YYYY-MM-DD date
+// (midnight UTC) query parameter, returning nil if absent.
+func optionalTimeParam(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s: use RFC 3339 or YYYY-MM-DD", name)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultSyncLimit = 100
+	maxSyncLimit     = 500
+)
+
+// SyncMessages returns the messages of a group (group_id) or of the caller's
+// direct conversation with a peer (peer_id) whose sequence numbers follow
+// after_seq, in order. Clients call it when the seq of an incoming frame
+// skips ahead, or after being offline. Numbers missing from a response
+// belong to deleted or expired messages, to messages sent before the caller
+// joined the group, or to senders the caller blocked; has_more means the
+// limit cut the range short.
+func (h *Handler) SyncMessages(w http.ResponseWriter, r *http.Request) {
+	userID, err := queryUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupID, err := optionalUintParam(r, "group_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	peerID, err := optionalUintParam(r, "peer_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (groupID == 0) == (peerID == 0) {
+		http.Error(w, "Exactly one of group_id or peer_id is required", http.StatusBadRequest)
+		return
+	}
+	afterSeq, err := strconv.ParseUint(r.URL.Query().Get("after_seq"), 10, 64)
+	if err != nil && r.URL.Query().Get("after_seq") != "" {
+		http.Error(w, "Invalid after_seq", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSyncLimit
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	if groupID != 0 {
+		if _, err := h.GroupService.GetMember(groupID, userID); err != nil {
+			http.Error(w, "You are not a member of this group", http.StatusForbidden)
+			return
+		}
+	}
+	conversation, err := h.MessageService.FindConversation(userID, groupID, peerID)
+	if err != nil {
+		http.Error(w, "Error fetching messages", http.StatusInternalServerError)
+		return
+	}
+	var lastSeq uint64
+	messages := []entity.Message{}
+	if conversation != nil {
+		lastSeq = conversation.LastSeq
+		if err := h.MessageService.DB.Where("conversation_id = ? AND seq > ?", conversation.ID, afterSeq).
+			Scopes(h.MessageService.SentWhileMember(userID), h.MessageService.NotExpired(), h.MessageService.NotBlockedBy(userID)).
+			Order("seq").Limit(limit + 1).Find(&messages).Error; err != nil {
+			http.Error(w, "Error fetching messages", http.StatusInternalServerError)
+			return
+		}
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	ids := make([]uint, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	attachments, err := h.AttachmentService.ForMessages(ids)
+	if err != nil {
+		http.Error(w, "Error loading attachments", http.StatusInternalServerError)
+		return
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": messages,
+		"last_seq": lastSeq,
+		"has_more": hasMore,
+	})
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"chat_app/entity"
+	"chat_app/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateWebhook registers an HTTPS endpoint for a set of event types. The
+// signing secret is only returned here.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || target.Scheme != "https" || target.Host == "" {
+		http.Error(w, "Webhook URL must be an absolute https URL", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		http.Error(w, "At least one event is required", http.StatusBadRequest)
+		return
+	}
+	var events []string
+	for _, event := range req.Events {
+		if !slices.Contains(entity.WebhookEvents, event) {
+			http.Error(w, fmt.Sprintf("Unknown event %q; expected one of %s", event, strings.Join(entity.WebhookEvents, ", ")), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		http.Error(w, "Error creating webhook secret", http.StatusInternalServerError)
+		return
+	}
+	webhook := entity.Webhook{
+		URL:       target.String(),
+		Events:    strings.Join(events, ","),
+		Secret:    secret,
+		CreatedBy: adminID(r),
+	}
+	if err := h.WebhookService.DB.Create(&webhook).Error; err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+	h.WebhookService.InvalidateWebhooks()
+	h.AdminService.Log(adminID(r), services.AdminActionCreateWebhook, "webhook", webhook.ID, fmt.Sprintf("url=%q events=%s", webhook.URL, webhook.Events))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     webhook.ID,
+		"url":    webhook.URL,
+		"events": events,
+		"secret": secret,
+	})
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	var webhooks []entity.Webhook
+	if err := h.WebhookService.DB.Order("id").Find(&webhooks).Error; err != nil {
+		http.Error(w, "Error fetching webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// loadWebhook parses the webhook_id path variable and fetches the webhook,
+// writing the error response itself when it returns false.
+func (h *Handler) loadWebhook(w http.ResponseWriter, r *http.Request) (*entity.Webhook, bool) {
+	webhookID, err := strconv.Atoi(mux.Vars(r)["webhook_id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var webhook entity.Webhook
+	if err := h.WebhookService.DB.First(&webhook, webhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error finding webhook", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// DeleteWebhook stops deliveries to a webhook. Its delivery log is kept;
+// pending deliveries end up as dead letters.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := h.WebhookService.DB.Delete(webhook).Error; err != nil {
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+	h.WebhookService.InvalidateWebhooks()
+	h.AdminService.Log(adminID(r), services.AdminActionDeleteWebhook, "webhook", webhook.ID, fmt.Sprintf("url=%q", webhook.URL))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Webhook deleted",
+	})
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest first,
+// optionally filtered by the status query parameter.
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	query := h.WebhookService.DB.Model(&entity.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	h.writeDeliveries(w, r, query)
+}
+
+// ListDeadLetters returns the deliveries of every webhook that ran out of
+// attempts.
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	h.writeDeliveries(w, r, h.WebhookService.DB.Model(&entity.WebhookDelivery{}).Where("status = ?", entity.DeliveryDead))
+}
+
+func (h *Handler) writeDeliveries(w http.ResponseWriter, r *http.Request, query *gorm.DB) {
+	page, pageSize := parsePagination(r)
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error counting deliveries", http.StatusInternalServerError)
+		return
+	}
+	deliveries := []entity.WebhookDelivery{}
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&deliveries).Error; err != nil {
+		http.Error(w, "Error fetching deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+	})
+}
+
+// RedeliverWebhook queues a dead letter for another round of attempts.
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["delivery_id"])
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	var delivery entity.WebhookDelivery
+	if err := h.WebhookService.DB.First(&delivery, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error finding delivery", http.StatusInternalServerError)
+		return
+	}
+	if delivery.Status != entity.DeliveryDead {
+		http.Error(w, "Only dead letters can be redelivered", http.StatusBadRequest)
+		return
+	}
+	if err := h.WebhookService.Redeliver(&delivery); err != nil {
+		http.Error(w, "Error queuing delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Delivery queued",
+	})
+}
@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"chat_app/entity"
+	"chat_app/services"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,13 +14,109 @@ import (
 
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received WebSocket request for path: %s", r.URL.Path)
+	userID, ok := h.streamUser(w, r)
+	if !ok {
+		return
+	}
+	h.WebSocketService.HandleConnections(w, r, userID)
+}
+
+// HandleEvents streams the user's frames as Server-Sent Events, for clients
+// whose proxies break WebSocket upgrades. They send with SendMessage.
+func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received event stream request for path: %s", r.URL.Path)
+	userID, ok := h.streamUser(w, r)
+	if !ok {
+		return
+	}
+	h.WebSocketService.ServeEvents(w, r, userID)
+}
+
+// HandlePoll returns the user's frames by long polling, for proxies that
+// also buffer event streams.
+func (h *Handler) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.streamUser(w, r)
+	if !ok {
+		return
+	}
+	h.WebSocketService.Poll(w, r, userID)
+}
+
+// streamUser reads the user_id path parameter of the real-time transports
+// and rejects disabled accounts and bots without their API key.
+func (h *Handler) streamUser(w http.ResponseWriter, r *http.Request) (uint, bool) {
 	vars := mux.Vars(r)
 	userIDStr := vars["user_id"]
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
 		log.Printf("Invalid user ID: %s", userIDStr)
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	var user entity.User
+	if err := h.AuthService.DB.First(&user, userID).Error; err == nil {
+		if user.DisabledAt != nil {
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+			return 0, false
+		}
+		if err := h.AuthService.VerifyBot(&user, r.Header.Get("Authorization")); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return 0, false
+		}
+	}
+	return uint(userID), true
+}
+
+// SendMessage accepts a message over REST, with the same fields and checks
+// as a WebSocket frame. Scheduled messages and resends are acknowledged in
+// the response; immediate messages are acknowledged, or their failure
+// reported, on the sender's sessions once delivered.
+func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"`
+		entity.Message
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var user entity.User
+	if err := h.AuthService.DB.First(&user, req.UserID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.DisabledAt != nil {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+	if err := h.AuthService.VerifyBot(&user, r.Header.Get("Authorization")); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	ack, err := h.WebSocketService.SubmitMessage(user.ID, req.Message)
+	if errors.Is(err, services.ErrScheduleFailed) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if ack == nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Message queued",
+		})
 		return
 	}
-	h.WebSocketService.HandleConnections(w, r, uint(userID))
+	json.NewEncoder(w).Encode(ack)
 }
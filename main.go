@@ -3,13 +3,17 @@ package main
 import (
 	"chat_app/config"
 	"chat_app/db"
+	"chat_app/grpcapi"
 	"chat_app/routes"
 	"chat_app/services"
+	"chat_app/storage"
 	"context"
 	"log"
+	"net"
 	"net/http"
 
 	"go.uber.org/fx"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -17,20 +21,39 @@ func main() {
 		fx.Provide(
 			config.NewConfig,
 			db.NewDB,
+			storage.NewBlobStore,
+			services.NewAttachmentService,
+			services.NewWebhookService,
 			services.NewAuthService,
 			services.NewWebSocketService,
 			services.NewSchedulerService,
 			services.NewGroupService,
+			services.NewMessageService,
+			services.NewAdminService,
 			routes.NewRoutes,
+			grpcapi.NewServer,
 		),
-		fx.Invoke(func(r *routes.Routes, ss *services.SchedulerService, lc fx.Lifecycle) {
+		fx.Invoke(func(r *routes.Routes, ss *services.SchedulerService, gs *grpc.Server, cfg *config.Config, lc fx.Lifecycle) {
 			router := r.SetupRoutes()
+
+			lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+			if err != nil {
+				log.Fatalf("Failed to listen for gRPC on :%s: %v", cfg.GRPCPort, err)
+			}
+			log.Printf("gRPC server starting on :%s", cfg.GRPCPort)
+			go func() {
+				if err := gs.Serve(lis); err != nil {
+					log.Printf("gRPC server stopped: %v", err)
+				}
+			}()
 			log.Println("Server starting on :8080")
 
 			lc.Append(fx.Hook{
 				OnStop: func(ctx context.Context) error {
 					ss.Stop()
 					log.Println("Scheduler stopped")
+					gs.GracefulStop()
+					log.Println("gRPC server stopped")
 					return nil
 				},
 			})
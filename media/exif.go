@@ -0,0 +1,298 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformedImage is returned when an image's metadata cannot be parsed,
+// so location data could not be removed.
+var ErrMalformedImage = errors.New("image metadata is malformed")
+
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// tiffTypeSizes maps TIFF field types to their size in bytes.
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// StripJPEGLocation removes GPS data from a JPEG: the GPS IFD inside the
+// EXIF segment is emptied and XMP segments, which may repeat the location,
+// are dropped. Other EXIF fields such as orientation are kept. It also
+// returns the EXIF orientation (1 if absent). Input whose segments cannot
+// all be parsed up to the image data fails with ErrMalformedImage.
+func StripJPEGLocation(data []byte) ([]byte, int, error) {
+	orientation := 1
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, ErrMalformedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	pos := 2
+	for pos+2 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, ErrMalformedImage
+		}
+		// Any number of 0xFF fill bytes may precede a marker
+		if data[pos+1] == 0xFF {
+			pos++
+			continue
+		}
+		marker := data[pos+1]
+		// Start of scan: the rest is entropy-coded image data
+		if marker == 0xDA {
+			out = append(out, data[pos:]...)
+			return out, orientation, nil
+		}
+		// Markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, ErrMalformedImage
+		}
+		segment := data[pos:end]
+		payload := segment[4:]
+
+		if marker == 0xE1 && bytes.HasPrefix(payload, xmpHeader) {
+			pos = end
+			continue
+		}
+		if marker == 0xE1 && bytes.HasPrefix(payload, exifHeader) {
+			cleaned := append([]byte(nil), segment...)
+			orientation = scrubTIFF(cleaned[4+len(exifHeader):])
+			segment = cleaned
+		}
+		out = append(out, segment...)
+		pos = end
+	}
+	return nil, 0, ErrMalformedImage
+}
+
+// scrubTIFF empties the GPS IFD of a TIFF structure in place and returns the
+// orientation found in IFD0.
+func scrubTIFF(tiff []byte) int {
+	orientation := 1
+	if len(tiff) < 8 {
+		return orientation
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientation
+	}
+
+	ifd0 := order.Uint32(tiff[4:8])
+	if uint64(ifd0)+2 > uint64(len(tiff)) {
+		return orientation
+	}
+	count := uint32(order.Uint16(tiff[ifd0 : ifd0+2]))
+	for i := uint32(0); i < count; i++ {
+		entry := ifd0 + 2 + i*12
+		if uint64(entry)+12 > uint64(len(tiff)) {
+			break
+		}
+		switch order.Uint16(tiff[entry : entry+2]) {
+		case tagOrientation:
+			if o := int(order.Uint16(tiff[entry+8 : entry+10])); o >= 1 && o <= 8 {
+				orientation = o
+			}
+		case tagGPSInfo:
+			clearIFD(tiff, order, order.Uint32(tiff[entry+8:entry+12]))
+		}
+	}
+	return orientation
+}
+
+// clearIFD zeroes every entry of an IFD and the out-of-line values they
+// point to, then marks the IFD as empty.
+func clearIFD(tiff []byte, order binary.ByteOrder, offset uint32) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return
+	}
+	count := uint32(order.Uint16(tiff[offset : offset+2]))
+	for i := uint32(0); i < count; i++ {
+		entry := offset + 2 + i*12
+		if uint64(entry)+12 > uint64(len(tiff)) {
+			break
+		}
+		size := tiffTypeSizes[order.Uint16(tiff[entry+2:entry+4])] * order.Uint32(tiff[entry+4:entry+8])
+		if size > 4 {
+			valueOffset := order.Uint32(tiff[entry+8 : entry+12])
+			if uint64(valueOffset)+uint64(size) <= uint64(len(tiff)) {
+				clear(tiff[valueOffset : valueOffset+size])
+			}
+		}
+		clear(tiff[entry : entry+12])
+	}
+	order.PutUint16(tiff[offset:offset+2], 0)
+	if uint64(offset)+6 <= uint64(len(tiff)) {
+		order.PutUint32(tiff[offset+2:offset+6], 0) // No next IFD
+	}
+}
+
+// StripPNGLocation drops the eXIf and XMP chunks of a PNG, which are where
+// location metadata lives, and anything after the IEND chunk. Input whose
+// chunks cannot all be parsed fails with ErrMalformedImage.
+func StripPNGLocation(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngMagic) {
+		return nil, ErrMalformedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngMagic...)
+	pos := len(pngMagic)
+	for pos+12 <= len(data) {
+		length := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if uint64(pos)+12+length > uint64(len(data)) {
+			return nil, ErrMalformedImage
+		}
+		end := pos + 12 + int(length)
+		chunkType := string(data[pos+4 : pos+8])
+		chunkData := data[pos+8 : end-4]
+		drop := chunkType == "eXIf" || (chunkType == "iTXt" && bytes.HasPrefix(chunkData, []byte("XML:com.adobe.xmp\x00")))
+		if !drop {
+			out = append(out, data[pos:end]...)
+		}
+		if chunkType == "IEND" {
+			return out, nil
+		}
+		pos = end
+	}
+	return nil, ErrMalformedImage
+}
+
+// StripWebPLocation drops the EXIF and XMP chunks of a WebP, clears their
+// flags in the VP8X header and drops anything after the RIFF container.
+// Input whose chunks cannot all be parsed fails with ErrMalformedImage.
+func StripWebPLocation(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformedImage
+	}
+	riffEnd := uint64(binary.LittleEndian.Uint32(data[4:8])) + 8
+	if riffEnd > uint64(len(data)) {
+		return nil, ErrMalformedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	pos := uint64(12)
+	for pos < riffEnd {
+		if pos+8 > riffEnd {
+			return nil, ErrMalformedImage
+		}
+		size := uint64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		// Chunks are padded to an even size
+		end := pos + 8 + size + size&1
+		if end > riffEnd {
+			return nil, ErrMalformedImage
+		}
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // The EXIF and XMP flags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
+
+// StripGIFLocation drops the application extensions of a GIF, where XMP and
+// other metadata live, except the NETSCAPE2.0 one that makes animations
+// loop. Anything after the trailer is dropped too. Input whose blocks
+// cannot all be parsed fails with ErrMalformedImage.
+func StripGIFLocation(data []byte) ([]byte, error) {
+	if len(data) < 13 || !(bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))) {
+		return nil, ErrMalformedImage
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1) // Global color table
+	}
+	if pos > len(data) {
+		return nil, ErrMalformedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:pos]...)
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x3B: // Trailer
+			return append(out, 0x3B), nil
+		case 0x21: // Extension
+			if pos+2 > len(data) {
+				return nil, ErrMalformedImage
+			}
+			end, ok := skipGIFSubBlocks(data, pos+2)
+			if !ok {
+				return nil, ErrMalformedImage
+			}
+			pos = end
+			if data[start+1] == 0xFF && !bytes.HasPrefix(data[start+2:end], []byte("\x0bNETSCAPE2.0")) {
+				continue
+			}
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return nil, ErrMalformedImage
+			}
+			pos += 10
+			if flags := data[pos-1]; flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1) // Local color table
+			}
+			pos++ // LZW minimum code size
+			end, ok := skipGIFSubBlocks(data, pos)
+			if !ok {
+				return nil, ErrMalformedImage
+			}
+			pos = end
+		default:
+			return nil, ErrMalformedImage
+		}
+		out = append(out, data[start:pos]...)
+	}
+	return nil, ErrMalformedImage
+}
+
+// skipGIFSubBlocks returns the position after the data sub-blocks starting
+// at pos, which end with an empty block.
+func skipGIFSubBlocks(data []byte, pos int) (int, bool) {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, true
+		}
+		pos += size
+	}
+	return 0, false
+}
@@ -0,0 +1,238 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// gpsLatitude is a recognizable out-of-line GPS value.
+var gpsLatitude = bytes.Repeat([]byte{0x11}, 24)
+
+// exifSegment builds an APP1 segment whose IFD0 has an orientation and a GPS
+// IFD with a latitude stored out of line.
+func exifSegment(orientation uint16) []byte {
+	le := binary.LittleEndian
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = append(tiff, ifdEntry(tagOrientation, 3, 1, uint32(orientation))...)
+	tiff = append(tiff, ifdEntry(tagGPSInfo, 4, 1, 38)...)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = le.AppendUint16(tiff, 1) // GPS IFD at 38
+	tiff = append(tiff, ifdEntry(0x0002, 5, 3, 56)...)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, gpsLatitude...) // At 56
+
+	payload := append(append([]byte(nil), exifHeader...), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func ifdEntry(tag, typ uint16, count, value uint32) []byte {
+	le := binary.LittleEndian
+	entry := le.AppendUint16(nil, tag)
+	entry = le.AppendUint16(entry, typ)
+	entry = le.AppendUint32(entry, count)
+	return le.AppendUint32(entry, value)
+}
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStripJPEGLocation(t *testing.T) {
+	plain := testJPEG(t)
+	withExif := func(prefix ...byte) []byte {
+		data := append([]byte(nil), plain[:2]...)
+		data = append(data, prefix...)
+		data = append(data, exifSegment(6)...)
+		return append(data, plain[2:]...)
+	}
+
+	tests := []struct {
+		name            string
+		data            []byte
+		wantOrientation int
+		wantErr         bool
+	}{
+		{"exif", withExif(), 6, false},
+		{"fill bytes before a marker", withExif(0xFF, 0xFF), 6, false},
+		{"no exif", plain, 1, false},
+		{"not a jpeg", []byte("GIF89a"), 0, true},
+		{"garbage between segments", withExif(0x00), 0, true},
+		{"truncated before the image data", withExif()[:40], 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleaned, orientation, err := StripJPEGLocation(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformedImage) || cleaned != nil {
+					t.Fatalf("got %d bytes, %v; want ErrMalformedImage", len(cleaned), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if orientation != tt.wantOrientation {
+				t.Fatalf("got orientation %d, want %d", orientation, tt.wantOrientation)
+			}
+			if bytes.Contains(cleaned, gpsLatitude) {
+				t.Fatal("GPS data was kept")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(cleaned)); err != nil {
+				t.Fatalf("cleaned image does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripPNGLocation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	ihdrEnd := len(pngMagic) + 25
+	data := append([]byte(nil), plain[:ihdrEnd]...)
+	data = append(data, pngChunk("eXIf", gpsLatitude)...)
+	data = append(data, plain[ihdrEnd:]...)
+	data = append(data, gpsLatitude...) // Trailing data after IEND
+
+	cleaned, err := StripPNGLocation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(cleaned, gpsLatitude) {
+		t.Fatal("location chunk or trailing data was kept")
+	}
+	if _, err := png.Decode(bytes.NewReader(cleaned)); err != nil {
+		t.Fatalf("cleaned image does not decode: %v", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"not a png":     []byte("\xFF\xD8\xFF"),
+		"truncated":     data[:len(data)/2],
+		"no IEND chunk": append(append([]byte(nil), pngMagic...), pngChunk("IHDR", nil)[:4]...),
+	} {
+		if _, err := StripPNGLocation(bad); !errors.Is(err, ErrMalformedImage) {
+			t.Errorf("%s: got %v, want ErrMalformedImage", name, err)
+		}
+	}
+}
+
+// testWebP is a 1x1 lossless WebP.
+const testWebP = "RIFF\x1a\x00\x00\x00WEBPVP8L\r\x00\x00\x00/\x00\x00\x00\x10\a\x10\x11\x11\x88\x88\xfe\a\x00"
+
+func webpChunk(fourCC string, data []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripWebPLocation(t *testing.T) {
+	// An extended WebP whose EXIF and XMP chunks both carry the location
+	vp8x := []byte{0x08 | 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0} // 1x1 canvas
+	body := []byte("WEBP")
+	body = append(body, webpChunk("VP8X", vp8x)...)
+	body = append(body, testWebP[12:]...)
+	body = append(body, webpChunk("EXIF", exifSegment(1)[4+len(exifHeader):])...)
+	body = append(body, webpChunk("XMP ", append([]byte("<x:xmpmeta>"), gpsLatitude...))...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+	data = append(data, gpsLatitude...) // Trailing data after the container
+	if _, err := webp.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("test image does not decode: %v", err)
+	}
+
+	cleaned, err := StripWebPLocation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(cleaned, gpsLatitude) {
+		t.Fatal("location chunk or trailing data was kept")
+	}
+	if flags := cleaned[20]; flags&(0x08|0x04) != 0 {
+		t.Fatalf("VP8X still flags metadata: %#x", flags)
+	}
+	if size := binary.LittleEndian.Uint32(cleaned[4:8]); int(size) != len(cleaned)-8 {
+		t.Fatalf("RIFF size %d, want %d", size, len(cleaned)-8)
+	}
+	if _, err := webp.Decode(bytes.NewReader(cleaned)); err != nil {
+		t.Fatalf("cleaned image does not decode: %v", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"not a webp":       []byte(testWebP[:8] + "WAVE"),
+		"truncated":        data[:len(data)/2],
+		"chunk past RIFF":  append([]byte("RIFF\x0c\x00\x00\x00WEBP"), webpChunk("VP8L", []byte{1, 2})...),
+		"no RIFF contents": []byte("RIFF"),
+	} {
+		if _, err := StripWebPLocation(bad); !errors.Is(err, ErrMalformedImage) {
+			t.Errorf("%s: got %v, want ErrMalformedImage", name, err)
+		}
+	}
+}
+
+func TestStripGIFLocation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	headerEnd := 13
+	if plain[10]&0x80 != 0 {
+		headerEnd += 3 << (plain[10]&0x07 + 1)
+	}
+	xmp := append([]byte("\x21\xFF\x0bXMP DataXMP"), byte(len(gpsLatitude)))
+	xmp = append(append(xmp, gpsLatitude...), 0)
+	data := append([]byte(nil), plain[:headerEnd]...)
+	data = append(data, xmp...)
+	data = append(data, plain[headerEnd:]...)
+	data = append(data, gpsLatitude...) // Trailing data after the trailer
+
+	cleaned, err := StripGIFLocation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(cleaned, gpsLatitude) {
+		t.Fatal("XMP extension or trailing data was kept")
+	}
+	if _, err := gif.Decode(bytes.NewReader(cleaned)); err != nil {
+		t.Fatalf("cleaned image does not decode: %v", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"not a gif":  []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00\x00"),
+		"truncated":  data[:len(data)/2],
+		"no trailer": plain[:len(plain)-1],
+	} {
+		if _, err := StripGIFLocation(bad); !errors.Is(err, ErrMalformedImage) {
+			t.Errorf("%s: got %v, want ErrMalformedImage", name, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package media extracts metadata from uploaded images and renders the
+// thumbnails and previews sent alongside message attachments.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ThumbnailSize = 320  // Longest edge of thumbnails, in pixels
+	PreviewSize   = 1280 // Longest edge of previews, in pixels
+	blurhashSize  = 32   // Blurhash is computed on a tiny copy of the image
+
+	// maxPixels guards against decompression bombs
+	maxPixels = 50_000_000
+)
+
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// ImageResult is the outcome of rendering an uploaded image.
+type ImageResult struct {
+	Width     int    // Display width, after applying EXIF orientation
+	Height    int    // Display height, after applying EXIF orientation
+	Thumbnail []byte // JPEG, at most ThumbnailSize on the longest edge
+	Preview   []byte // JPEG, at most PreviewSize on the longest edge
+	Blurhash  string
+}
+
+// IsImage reports whether the content type is an image format this package
+// can decode.
+func IsImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// StripLocation removes location metadata from an image and returns the
+// EXIF orientation (1 if absent). It fails with ErrMalformedImage rather
+// than return bytes that may still carry a location, including for formats
+// it cannot strip.
+func StripLocation(data []byte, contentType string) ([]byte, int, error) {
+	var cleaned []byte
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		return StripJPEGLocation(data)
+	case "image/png":
+		cleaned, err = StripPNGLocation(data)
+	case "image/webp":
+		cleaned, err = StripWebPLocation(data)
+	case "image/gif":
+		cleaned, err = StripGIFLocation(data)
+	default:
+		err = ErrMalformedImage
+	}
+	return cleaned, 1, err
+}
+
+// ProcessImage renders thumbnails, a preview and a blurhash placeholder for
+// an image already passed through StripLocation.
+func ProcessImage(data []byte, orientation int) (*ImageResult, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+
+	// Downscale before rotating so orientation is applied to small images only
+	preview := orient(resize(img, PreviewSize), orientation)
+	thumbnail := resize(preview, ThumbnailSize)
+
+	result := &ImageResult{
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Blurhash: Blurhash(resize(thumbnail, blurhashSize), 4, 3),
+	}
+	if orientation >= 5 {
+		result.Width, result.Height = cfg.Height, cfg.Width
+	}
+	if result.Preview, err = encodeJPEG(preview); err != nil {
+		return nil, err
+	}
+	if result.Thumbnail, err = encodeJPEG(thumbnail); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// resize scales the image so its longest edge is at most maxEdge, keeping
+// the aspect ratio. Transparent areas are flattened onto white.
+func resize(img image.Image, maxEdge int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxEdge || height > maxEdge {
+		if width >= height {
+			height = max(1, height*maxEdge/width)
+			width = maxEdge
+		} else {
+			width = max(1, width*maxEdge/height)
+			height = maxEdge
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // Rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // Mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -12,17 +12,20 @@ type Routes struct {
 	Handler *handler.Handler
 }
 
-func NewRoutes(authService *services.AuthService, groupService *services.GroupService, wsService *services.WebSocketService) *Routes {
+func NewRoutes(authService *services.AuthService, groupService *services.GroupService, wsService *services.WebSocketService, messageService *services.MessageService, adminService *services.AdminService, attachmentService *services.AttachmentService, webhookService *services.WebhookService) *Routes {
 	return &Routes{
-		Handler: handler.NewHandler(authService, groupService, wsService),
+		Handler: handler.NewHandler(authService, groupService, wsService, messageService, adminService, attachmentService, webhookService),
 	}
 }
 
 func (r *Routes) SetupRoutes() *mux.Router {
 	router := mux.NewRouter()
 
-	// WebSocket route
+	// Real-time routes; events and poll are fallbacks for proxies that
+	// break WebSocket upgrades, with messages sent through POST /messages
 	router.HandleFunc("/ws/{user_id}", r.Handler.HandleWebSocket).Methods("GET")
+	router.HandleFunc("/events/{user_id}", r.Handler.HandleEvents).Methods("GET")
+	router.HandleFunc("/poll/{user_id}", r.Handler.HandlePoll).Methods("GET")
 
 	// Auth routes
 	router.HandleFunc("/register", r.Handler.Register).Methods("POST")
@@ -33,7 +36,98 @@ func (r *Routes) SetupRoutes() *mux.Router {
 	// Group routes
 	router.HandleFunc("/groups", r.Handler.CreateGroup).Methods("POST")
 	router.HandleFunc("/groups", r.Handler.ListGroups).Methods("GET")
+	router.HandleFunc("/groups/mine", r.Handler.ListMyGroups).Methods("GET")
+	router.HandleFunc("/groups/{group_id}", r.Handler.UpdateGroup).Methods("PATCH")
+	router.HandleFunc("/groups/{group_id}", r.Handler.DeleteGroup).Methods("DELETE")
+	router.HandleFunc("/groups/{group_id}/archive", r.Handler.ArchiveGroup).Methods("POST")
+	router.HandleFunc("/groups/{group_id}/unarchive", r.Handler.UnarchiveGroup).Methods("POST")
+	router.HandleFunc("/groups/{group_id}/join", r.Handler.JoinGroup).Methods("POST")
+	router.HandleFunc("/groups/{group_id}/join-requests", r.Handler.ListJoinRequests).Methods("GET")
+	router.HandleFunc("/groups/{group_id}/join-requests/{request_id}/approve", r.Handler.ApproveJoinRequest).Methods("POST")
+	router.HandleFunc("/groups/{group_id}/join-requests/{request_id}/reject", r.Handler.RejectJoinRequest).Methods("POST")
 	router.HandleFunc("/groups/{group_id}/members", r.Handler.HandleGroupMembers).Methods("POST", "GET", "DELETE")
+	router.HandleFunc("/groups/{group_id}/members/{member_id}", r.Handler.ChangeMemberRole).Methods("PATCH")
+	router.HandleFunc("/groups/{group_id}/leave", r.Handler.LeaveGroup).Methods("POST")
+	router.HandleFunc("/groups/{group_id}/notifications", r.Handler.SetGroupNotifications).Methods("PUT")
+
+	// Moderation routes
+	router.HandleFunc("/groups/{group_id}/mutes", r.Handler.MuteMember).Methods("POST")
+	router.HandleFunc("/groups/{group_id}/mutes/{member_id}", r.Handler.UnmuteMember).Methods("DELETE")
+	router.HandleFunc("/groups/{group_id}/bans", r.Handler.HandleGroupBans).Methods("POST", "GET")
+	router.HandleFunc("/groups/{group_id}/bans/{member_id}", r.Handler.UnbanMember).Methods("DELETE")
+	router.HandleFunc("/groups/{group_id}/slow-mode", r.Handler.SetSlowMode).Methods("PUT")
+	router.HandleFunc("/groups/{group_id}/disappearing", r.Handler.SetGroupTimer).Methods("PUT")
+	router.HandleFunc("/groups/{group_id}/audit-log", r.Handler.ListAuditLog).Methods("GET")
+	router.HandleFunc("/groups/{group_id}/invites", r.Handler.HandleGroupInvites).Methods("POST", "GET")
+	router.HandleFunc("/groups/{group_id}/incoming-webhooks", r.Handler.HandleIncomingWebhooks).Methods("POST", "GET")
+	router.HandleFunc("/groups/{group_id}/incoming-webhooks/{webhook_id}", r.Handler.RevokeIncomingWebhook).Methods("DELETE")
+
+	// Bot routes; bots act with an "Authorization: Bot <api key>" header
+	router.HandleFunc("/bots", r.Handler.CreateBot).Methods("POST")
+	router.HandleFunc("/bots", r.Handler.ListBots).Methods("GET")
+	router.HandleFunc("/bots/{bot_id}", r.Handler.DeleteBot).Methods("DELETE")
+	router.HandleFunc("/bots/{bot_id}/api-key", r.Handler.RotateBotKey).Methods("POST")
+	router.HandleFunc("/bots/{bot_id}/commands", r.Handler.RegisterCommand).Methods("POST")
+	router.HandleFunc("/bots/{bot_id}/commands/{command}", r.Handler.UnregisterCommand).Methods("DELETE")
+	router.HandleFunc("/commands", r.Handler.ListCommands).Methods("GET")
+	router.HandleFunc("/commands/invocations/{invocation_id}/respond", r.Handler.RespondToCommand).Methods("POST")
+	router.HandleFunc("/interactions/{interaction_id}/respond", r.Handler.RespondToInteraction).Methods("POST")
+
+	// Incoming webhook posts, authenticated by the secret token
+	router.HandleFunc("/hooks/{token}", r.Handler.PostIncomingWebhook).Methods("POST")
+
+	// Invite routes
+	router.HandleFunc("/invites/{token}/join", r.Handler.JoinWithInvite).Methods("POST")
+	router.HandleFunc("/invites/{token}", r.Handler.RevokeInvite).Methods("DELETE")
+
+	// Message routes
+	router.HandleFunc("/messages", r.Handler.SendMessage).Methods("POST")
+	router.HandleFunc("/messages/{message_id}/reactions", r.Handler.HandleReactions).Methods("POST", "GET", "DELETE")
+	router.HandleFunc("/messages/{message_id}/pin", r.Handler.PinMessage).Methods("POST")
+	router.HandleFunc("/messages/{message_id}/pin", r.Handler.UnpinMessage).Methods("DELETE")
+	router.HandleFunc("/messages/{message_id}/star", r.Handler.StarMessage).Methods("POST")
+	router.HandleFunc("/messages/{message_id}/star", r.Handler.UnstarMessage).Methods("DELETE")
+	router.HandleFunc("/messages/{message_id}/forward", r.Handler.ForwardMessage).Methods("POST")
+	router.HandleFunc("/pins", r.Handler.ListPins).Methods("GET")
+	router.HandleFunc("/starred", r.Handler.ListStarred).Methods("GET")
+	router.HandleFunc("/sync", r.Handler.SyncMessages).Methods("GET")
+
+	// Conversation routes
+	router.HandleFunc("/conversations", r.Handler.ListConversations).Methods("GET")
+	router.HandleFunc("/direct/{peer_id}/disappearing", r.Handler.GetDirectTimer).Methods("GET")
+	router.HandleFunc("/direct/{peer_id}/disappearing", r.Handler.SetDirectTimer).Methods("PUT")
+
+	// Mention routes
+	router.HandleFunc("/mentions", r.Handler.ListMentions).Methods("GET")
+
+	// Search routes
+	router.HandleFunc("/search/messages", r.Handler.SearchMessages).Methods("GET")
+
+	// Attachment routes
+	router.HandleFunc("/attachments", r.Handler.UploadAttachment).Methods("POST")
+	router.HandleFunc("/attachments/{attachment_id}", r.Handler.DownloadAttachment).Methods("GET")
+	router.HandleFunc("/attachments/{attachment_id}", r.Handler.DeleteAttachment).Methods("DELETE")
+	router.HandleFunc("/attachments/{attachment_id}/thumbnail", r.Handler.DownloadThumbnail).Methods("GET")
+	router.HandleFunc("/attachments/{attachment_id}/preview", r.Handler.DownloadPreview).Methods("GET")
+
+	// Admin routes; every request must carry an administrator's user_id
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(r.Handler.RequireAdmin)
+	admin.HandleFunc("/users", r.Handler.AdminListUsers).Methods("GET")
+	admin.HandleFunc("/users/{target_id}/disable", r.Handler.AdminDisableUser).Methods("POST")
+	admin.HandleFunc("/users/{target_id}/enable", r.Handler.AdminEnableUser).Methods("POST")
+	admin.HandleFunc("/users/{target_id}/reset-password", r.Handler.AdminResetPassword).Methods("POST")
+	admin.HandleFunc("/users/{target_id}/role", r.Handler.AdminChangeRole).Methods("PUT")
+	admin.HandleFunc("/groups/{group_id}", r.Handler.AdminDeleteGroup).Methods("DELETE")
+	admin.HandleFunc("/announcements", r.Handler.AdminAnnounce).Methods("POST")
+	admin.HandleFunc("/stats", r.Handler.AdminStats).Methods("GET")
+	admin.HandleFunc("/audit-log", r.Handler.AdminAuditLog).Methods("GET")
+	admin.HandleFunc("/webhooks", r.Handler.CreateWebhook).Methods("POST")
+	admin.HandleFunc("/webhooks", r.Handler.ListWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks/{webhook_id}", r.Handler.DeleteWebhook).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{webhook_id}/deliveries", r.Handler.ListWebhookDeliveries).Methods("GET")
+	admin.HandleFunc("/webhook-deliveries/dead", r.Handler.ListDeadLetters).Methods("GET")
+	admin.HandleFunc("/webhook-deliveries/{delivery_id}/redeliver", r.Handler.RedeliverWebhook).Methods("POST")
 
 	log.Println("Routes set up successfully")
 	return router
@@ -5,7 +5,7 @@ CURRENT_DIR=$1
 rm -rf "${CURRENT_DIR}/genproto"
 find "${CURRENT_DIR}/protocol-buffers" -type f -name "*.proto" -print0 | while IFS= read -r -d '' file; do
     protoc -I="${CURRENT_DIR}/protocol-buffers" \
-           --go_out=${CURRENT_DIR} \
-           --go-grpc_out=${CURRENT_DIR} \
+           --go_out=${CURRENT_DIR} --go_opt=module=chat_app \
+           --go-grpc_out=${CURRENT_DIR} --go-grpc_opt=module=chat_app \
            "${file}"
 done
@@ -0,0 +1,339 @@
+// Package bot is a client for writing chat bots. A bot connects with its
+// user ID and API key, receives the messages and events of the
+// conversations it is in, answers the slash commands registered for it and
+// handles clicks on the interactive messages it sends.
+//
+//	b := bot.New("http://localhost:8080", botID, apiKey)
+//	b.HandleCommand("deploy", func(ctx context.Context, cmd *bot.Command) {
+//		cmd.ReplyInChannel(ctx, "Deploying "+cmd.Args)
+//	})
+//	b.HandleInteraction("approve", func(ctx context.Context, i *bot.Interaction) {
+//		i.Update(ctx, "Approved", nil)
+//	})
+//	log.Fatal(b.Run(ctx))
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrUnauthorized is returned by Run when the server rejects the API key.
+var ErrUnauthorized = errors.New("bot: API key was rejected")
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Message is a chat message delivered to the bot.
+type Message struct {
+	ID             uint      `json:"ID"`
+	CreatedAt      time.Time `json:"CreatedAt"`
+	SenderID       uint      `json:"sender_id"`
+	ReceiverID     uint      `json:"receiver_id"`
+	GroupID        uint      `json:"group_id"`
+	ConversationID uint      `json:"conversation_id"`
+	Seq            uint64    `json:"seq"`
+	Content        string    `json:"content"`
+	Format         string    `json:"format"`
+	Blocks         []Block   `json:"blocks"`
+	Kind           string    `json:"kind"`
+	SystemEvent    string    `json:"system_event"`
+}
+
+// Event is any other frame with an "event" field, such as a reaction or a
+// pin. Data holds the whole frame.
+type Event struct {
+	Name string
+	Data map[string]interface{}
+}
+
+// Command is an invocation of one of the bot's slash commands.
+type Command struct {
+	InvocationID uint   `json:"invocation_id"`
+	Command      string `json:"command"`
+	Args         string `json:"args"`
+	UserID       uint   `json:"user_id"`     // Who invoked it
+	GroupID      uint   `json:"group_id"`    // 0 in a direct conversation
+	ReceiverID   uint   `json:"receiver_id"` // The bot, in a direct conversation
+
+	bot *Bot
+}
+
+type (
+	CommandHandler     func(ctx context.Context, cmd *Command)
+	InteractionHandler func(ctx context.Context, interaction *Interaction)
+	MessageHandler     func(ctx context.Context, msg *Message)
+	EventHandler       func(ctx context.Context, event *Event)
+)
+
+// Bot is a connection to the chat server. Register handlers before Run.
+type Bot struct {
+	BaseURL    string // HTTP base URL of the server, e.g. http://localhost:8080
+	ID         uint   // The bot's user ID
+	APIKey     string
+	HTTPClient *http.Client
+
+	mu           sync.Mutex
+	commands     map[string]CommandHandler
+	interactions map[string]InteractionHandler
+	onMessage    MessageHandler
+	onEvent      EventHandler
+}
+
+func New(baseURL string, id uint, apiKey string) *Bot {
+	return &Bot{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		ID:           id,
+		APIKey:       apiKey,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		commands:     make(map[string]CommandHandler),
+		interactions: make(map[string]InteractionHandler),
+	}
+}
+
+// HandleCommand sets the handler of a slash command, given without the
+// slash. Handlers run on their own goroutine.
+func (b *Bot) HandleCommand(command string, handler CommandHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands[command] = handler
+}
+
+// HandleInteraction sets the handler of an element of the bot's interactive
+// messages by its action ID, or of a form by its block ID. Handlers run on
+// their own goroutine.
+func (b *Bot) HandleInteraction(actionID string, handler InteractionHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.interactions[actionID] = handler
+}
+
+// OnMessage sets the handler of messages from others in the bot's groups
+// and direct conversations.
+func (b *Bot) OnMessage(handler MessageHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onMessage = handler
+}
+
+// OnEvent sets the handler of events other than commands and interactions.
+func (b *Bot) OnEvent(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onEvent = handler
+}
+
+// Run connects and dispatches frames until ctx is done. Dropped
+// connections are resumed, so no frame is lost within the server's grace
+// period.
+func (b *Bot) Run(ctx context.Context) error {
+	var resumeToken string
+	var lastSeq uint64
+	delay := minReconnectDelay
+	for {
+		err := b.session(ctx, &resumeToken, &lastSeq, func() { delay = minReconnectDelay })
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			return err
+		}
+		log.Printf("bot: connection lost, reconnecting in %v: %v", delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// session serves one connection, resuming the previous session if possible.
+func (b *Bot) session(ctx context.Context, resumeToken *string, lastSeq *uint64, connected func()) error {
+	url := strings.Replace(b.BaseURL, "http", "ws", 1) + "/ws/" + strconv.FormatUint(uint64(b.ID), 10)
+	if *resumeToken != "" {
+		url += fmt.Sprintf("?resume_token=%s&last_seq=%d", *resumeToken, *lastSeq)
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bot "+b.APIKey)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return ErrUnauthorized
+		}
+		return err
+	}
+	defer conn.Close()
+	connected()
+
+	// Unblock the read when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var frame map[string]interface{}
+		if err := json.Unmarshal(data, &frame); err != nil {
+			log.Printf("bot: ignoring malformed frame: %v", err)
+			continue
+		}
+		if seq, ok := frame["session_seq"].(float64); ok {
+			*lastSeq = uint64(seq)
+		}
+		if token, ok := frame["resume_token"].(string); ok {
+			if resumed, _ := frame["resumed"].(bool); !resumed {
+				*lastSeq = 0
+			}
+			*resumeToken = token
+			continue
+		}
+		b.dispatch(ctx, frame, data)
+	}
+}
+
+func (b *Bot) dispatch(ctx context.Context, frame map[string]interface{}, data []byte) {
+	b.mu.Lock()
+	onMessage, onEvent := b.onMessage, b.onEvent
+	b.mu.Unlock()
+
+	if text, ok := frame["error"].(string); ok {
+		log.Printf("bot: server error: %s", text)
+		return
+	}
+	name, isEvent := frame["event"].(string)
+	switch {
+	case name == "command":
+		cmd := &Command{bot: b}
+		if err := json.Unmarshal(data, cmd); err != nil {
+			log.Printf("bot: malformed command: %v", err)
+			return
+		}
+		b.mu.Lock()
+		handler, ok := b.commands[cmd.Command]
+		b.mu.Unlock()
+		if !ok {
+			handler = func(ctx context.Context, cmd *Command) {
+				cmd.Reply(ctx, fmt.Sprintf("/%s is not available right now.", cmd.Command))
+			}
+		}
+		go handler(ctx, cmd)
+	case name == "interaction":
+		interaction := &Interaction{bot: b}
+		if err := json.Unmarshal(data, interaction); err != nil {
+			log.Printf("bot: malformed interaction: %v", err)
+			return
+		}
+		b.mu.Lock()
+		handler, ok := b.interactions[interaction.ActionID]
+		b.mu.Unlock()
+		if !ok {
+			handler = func(ctx context.Context, interaction *Interaction) {
+				interaction.Reply(ctx, "This action is not available right now.")
+			}
+		}
+		go handler(ctx, interaction)
+	case isEvent:
+		if onEvent != nil {
+			onEvent(ctx, &Event{Name: name, Data: frame})
+		}
+	default:
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("bot: malformed message: %v", err)
+			return
+		}
+		if msg.SenderID != b.ID && onMessage != nil {
+			onMessage(ctx, &msg)
+		}
+	}
+}
+
+// Send posts a message as the bot to a group or a direct peer. Set format
+// to "markdown" for formatted text, or leave it empty.
+func (b *Bot) Send(ctx context.Context, groupID, receiverID uint, text, format string) error {
+	return b.post(ctx, "/messages", map[string]interface{}{
+		"user_id":     b.ID,
+		"group_id":    groupID,
+		"receiver_id": receiverID,
+		"content":     text,
+		"format":      format,
+	})
+}
+
+// SendBlocks posts an interactive message as the bot. Text is shown by
+// clients that cannot render blocks.
+func (b *Bot) SendBlocks(ctx context.Context, groupID, receiverID uint, text string, blocks []Block) error {
+	return b.post(ctx, "/messages", map[string]interface{}{
+		"user_id":     b.ID,
+		"group_id":    groupID,
+		"receiver_id": receiverID,
+		"content":     text,
+		"blocks":      blocks,
+	})
+}
+
+// Reply answers the command to its invoker only.
+func (c *Command) Reply(ctx context.Context, text string) error {
+	return c.respond(ctx, "ephemeral", text)
+}
+
+// ReplyInChannel answers the command in the conversation it was sent in,
+// visible to everyone there.
+func (c *Command) ReplyInChannel(ctx context.Context, text string) error {
+	return c.respond(ctx, "in_channel", text)
+}
+
+func (c *Command) respond(ctx context.Context, visibility, text string) error {
+	return c.bot.post(ctx, fmt.Sprintf("/commands/invocations/%d/respond", c.InvocationID), map[string]interface{}{
+		"user_id":    c.bot.ID,
+		"visibility": visibility,
+		"text":       text,
+	})
+}
+
+func (b *Bot) post(ctx context.Context, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+b.APIKey)
+	resp, err := b.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("bot: %s %s: %s: %s", http.MethodPost, path, resp.Status, strings.TrimSpace(string(text)))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+)
+
+// Block types.
+const (
+	BlockSection = "section"
+	BlockActions = "actions"
+	BlockForm    = "form"
+)
+
+// Element types.
+const (
+	ElementButton    = "button"
+	ElementSelect    = "select"
+	ElementTextInput = "text_input"
+)
+
+// Block is a section of text, a row of buttons and select menus, or a form
+// of an interactive message. A form is submitted with its BlockID as the
+// action ID.
+type Block struct {
+	Type        string    `json:"type"`
+	BlockID     string    `json:"block_id,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	Elements    []Element `json:"elements,omitempty"`
+	SubmitLabel string    `json:"submit_label,omitempty"`
+}
+
+type Element struct {
+	Type        string   `json:"type"`
+	ActionID    string   `json:"action_id"`
+	Label       string   `json:"label,omitempty"`
+	Value       string   `json:"value,omitempty"`
+	Style       string   `json:"style,omitempty"` // primary or danger
+	Options     []Option `json:"options,omitempty"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Multiline   bool     `json:"multiline,omitempty"`
+}
+
+type Option struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Section returns a block of text.
+func Section(text string) Block {
+	return Block{Type: BlockSection, Text: text}
+}
+
+// Actions returns a row of buttons and select menus.
+func Actions(elements ...Element) Block {
+	return Block{Type: BlockActions, Elements: elements}
+}
+
+// Button returns a button that submits value when clicked.
+func Button(actionID, label, value string) Element {
+	return Element{Type: ElementButton, ActionID: actionID, Label: label, Value: value}
+}
+
+// Interaction is a click, choice or form submission on one of the bot's
+// messages.
+type Interaction struct {
+	InteractionID uint              `json:"interaction_id"`
+	MessageID     uint              `json:"message_id"`
+	ActionID      string            `json:"action_id"`
+	Value         string            `json:"value"`  // The button's value or the chosen option
+	Values        map[string]string `json:"values"` // Form fields by action ID
+	UserID        uint              `json:"user_id"`
+	GroupID       uint              `json:"group_id"`
+	ReceiverID    uint              `json:"receiver_id"`
+
+	bot *Bot
+}
+
+// Update replaces the text and blocks of the message in place for everyone
+// who sees it. Nil blocks turn it into a plain message.
+func (i *Interaction) Update(ctx context.Context, text string, blocks []Block) error {
+	if blocks == nil {
+		blocks = []Block{}
+	}
+	return i.respond(ctx, map[string]interface{}{
+		"update": map[string]interface{}{
+			"content": text,
+			"blocks":  blocks,
+		},
+	})
+}
+
+// Reply answers the user who interacted only.
+func (i *Interaction) Reply(ctx context.Context, text string) error {
+	return i.respond(ctx, map[string]interface{}{
+		"reply": text,
+	})
+}
+
+func (i *Interaction) respond(ctx context.Context, body map[string]interface{}) error {
+	body["user_id"] = i.bot.ID
+	return i.bot.post(ctx, fmt.Sprintf("/interactions/%d/respond", i.InteractionID), body)
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"chat_app/entity"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AdminActionDisableUser   = "disable_user"
+	AdminActionEnableUser    = "enable_user"
+	AdminActionResetPassword = "reset_password"
+	AdminActionChangeRole    = "change_role"
+	AdminActionDeleteGroup   = "delete_group"
+	AdminActionAnnouncement  = "announcement"
+	AdminActionCreateWebhook = "create_webhook"
+	AdminActionDeleteWebhook = "delete_webhook"
+)
+
+type AdminService struct {
+	DB *gorm.DB
+}
+
+func NewAdminService(db *gorm.DB) *AdminService {
+	return &AdminService{DB: db}
+}
+
+// IsAdmin reports whether the user exists, is active and is a server administrator.
+func (as *AdminService) IsAdmin(userID uint) bool {
+	var user entity.User
+	if err := as.DB.First(&user, userID).Error; err != nil {
+		return false
+	}
+	return user.IsAdmin() && user.DisabledAt == nil
+}
+
+// Log appends an entry to the admin audit log.
+func (as *AdminService) Log(adminID uint, action, targetType string, targetID uint, details string) {
+	entry := entity.AdminAuditLog{
+		AdminID:    adminID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	}
+	if err := as.DB.Create(&entry).Error; err != nil {
+		log.Printf("Error writing admin audit log: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"bytes"
+	"chat_app/config"
+	"chat_app/entity"
+	"chat_app/media"
+	"chat_app/storage"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"gorm.io/gorm"
+)
+
+// MaxAttachmentsPerMessage caps how many files one message may carry.
+const MaxAttachmentsPerMessage = 10
+
+var (
+	ErrAttachmentTooLarge = errors.New("attachment exceeds the upload size limit")
+	ErrQuotaExceeded      = errors.New("attachment storage quota exceeded")
+	ErrAttachmentInvalid  = errors.New("attachments must be your own uploads and not already sent")
+	ErrImageMalformed     = errors.New("image could not be read to remove its location metadata")
+)
+
+type AttachmentService struct {
+	DB     *gorm.DB
+	Store  storage.BlobStore
+	Config *config.Config
+}
+
+func NewAttachmentService(db *gorm.DB, store storage.BlobStore, cfg *config.Config) *AttachmentService {
+	return &AttachmentService{DB: db, Store: store, Config: cfg}
+}
+
+// Upload stores a new, unattached file for the uploader. The content type is
+// sniffed from the first bytes rather than trusted from the client.
+func (as *AttachmentService) Upload(ctx context.Context, uploaderID uint, fileName string, size int64, r io.Reader) (*entity.Attachment, error) {
+	if size > as.Config.MaxUploadBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	used, err := as.UsedBytes(uploaderID)
+	if err != nil {
+		return nil, err
+	}
+	if used+size > as.Config.UserQuotaBytes {
+		return nil, ErrQuotaExceeded
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+
+	key, err := newStorageKey()
+	if err != nil {
+		return nil, err
+	}
+	attachment := entity.Attachment{
+		UploaderID:  uploaderID,
+		StorageKey:  key,
+		FileName:    path.Base(fileName),
+		ContentType: contentType,
+		Size:        size,
+	}
+	body := io.MultiReader(bytes.NewReader(head), r)
+	if media.IsImage(contentType) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		// Only the stripped bytes are ever stored
+		cleaned, orientation, err := media.StripLocation(data, contentType)
+		if err != nil {
+			return nil, ErrImageMalformed
+		}
+		body = bytes.NewReader(cleaned)
+		attachment.Size = int64(len(cleaned))
+		if err := as.renderImage(ctx, &attachment, cleaned, orientation); err != nil {
+			// Keep the upload as a plain file without previews
+			log.Printf("Error processing image upload %q: %v", fileName, err)
+		}
+	}
+
+	if err := as.Store.Put(ctx, key, body, attachment.Size, contentType); err != nil {
+		as.deleteBlobs(ctx, &attachment)
+		return nil, fmt.Errorf("storing blob: %w", err)
+	}
+
+	if err := as.DB.Create(&attachment).Error; err != nil {
+		as.deleteBlobs(ctx, &attachment)
+		return nil, err
+	}
+	attachment.SetURLs()
+	return &attachment, nil
+}
+
+// renderImage stores the thumbnail and preview of an image upload, whose
+// location metadata is already stripped, and fills in its metadata.
+func (as *AttachmentService) renderImage(ctx context.Context, attachment *entity.Attachment, data []byte, orientation int) error {
+	result, err := media.ProcessImage(data, orientation)
+	if err != nil {
+		return err
+	}
+
+	thumbnailKey := attachment.StorageKey + ".thumb.jpg"
+	if err := as.Store.Put(ctx, thumbnailKey, bytes.NewReader(result.Thumbnail), int64(len(result.Thumbnail)), "image/jpeg"); err != nil {
+		return fmt.Errorf("storing thumbnail: %w", err)
+	}
+
+	previewKey := attachment.StorageKey + ".preview.jpg"
+	if err := as.Store.Put(ctx, previewKey, bytes.NewReader(result.Preview), int64(len(result.Preview)), "image/jpeg"); err != nil {
+		as.Store.Delete(ctx, thumbnailKey)
+		return fmt.Errorf("storing preview: %w", err)
+	}
+
+	attachment.ThumbnailKey = thumbnailKey
+	attachment.PreviewKey = previewKey
+
+	attachment.Width = result.Width
+	attachment.Height = result.Height
+	attachment.Blurhash = result.Blurhash
+	return nil
+}
+
+// Validate checks that every ID names an unattached upload of the sender.
+func (as *AttachmentService) Validate(senderID uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids) > MaxAttachmentsPerMessage {
+		return fmt.Errorf("a message can carry at most %d attachments", MaxAttachmentsPerMessage)
+	}
+	var count int64
+	if err := as.DB.Model(&entity.Attachment{}).
+		Where("id IN ? AND uploader_id = ? AND message_id = 0", ids, senderID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(uniqueIDs(ids)) {
+		return ErrAttachmentInvalid
+	}
+	return nil
+}
+
+// Link attaches validated uploads to a message. It fails with
+// ErrAttachmentInvalid if any of them was sent in the meantime, so callers
+// run it in the transaction that stores the message.
+func (as *AttachmentService) Link(tx *gorm.DB, messageID, senderID uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	result := tx.Model(&entity.Attachment{}).
+		Where("id IN ? AND uploader_id = ? AND message_id = 0", ids, senderID).
+		Update("message_id", messageID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if int(result.RowsAffected) != len(uniqueIDs(ids)) {
+		return ErrAttachmentInvalid
+	}
+	return nil
+}
+
+// UsedBytes returns the storage charged to an uploader. Forwarded copies
+// share a blob with the original, so each blob is counted once.
+func (as *AttachmentService) UsedBytes(uploaderID uint) (int64, error) {
+	var used int64
+	blobs := as.DB.Model(&entity.Attachment{}).Distinct("storage_key", "size").Where("uploader_id = ?", uploaderID)
+	err := as.DB.Table("(?) AS blobs", blobs).Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// CopyForForward attaches copies of a message's attachments to the stored
+// forward. Copies share the original blobs, so they stay charged to the
+// original uploader; see UsedBytes and Delete.
+func (as *AttachmentService) CopyForForward(messageID uint, sources []entity.Attachment) error {
+	return as.DB.Transaction(func(tx *gorm.DB) error {
+		for _, source := range sources {
+			attachment := source
+			attachment.Model = gorm.Model{}
+			attachment.MessageID = messageID
+			if err := tx.Create(&attachment).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForMessage returns the attachments of a message in upload order.
+func (as *AttachmentService) ForMessage(messageID uint) ([]entity.Attachment, error) {
+	var attachments []entity.Attachment
+	err := as.DB.Where("message_id = ?", messageID).Order("id").Find(&attachments).Error
+	return attachments, err
+}
+
+// ForMessages returns the attachments of several messages, keyed by message ID.
+func (as *AttachmentService) ForMessages(messageIDs []uint) (map[uint][]entity.Attachment, error) {
+	byMessage := make(map[uint][]entity.Attachment)
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+	var attachments []entity.Attachment
+	if err := as.DB.Where("message_id IN ?", messageIDs).Order("id").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		byMessage[attachment.MessageID] = append(byMessage[attachment.MessageID], attachment)
+	}
+	return byMessage, nil
+}
+
+// Delete removes an attachment row and its blobs. Blobs are kept while a
+// forwarded copy still refers to them.
+func (as *AttachmentService) Delete(ctx context.Context, attachment *entity.Attachment) error {
+	return as.remove(ctx, as.DB, attachment)
+}
+
+// Purge is like Delete but hard-deletes the row, leaving no trace of it.
+func (as *AttachmentService) Purge(ctx context.Context, attachment *entity.Attachment) error {
+	return as.remove(ctx, as.DB.Unscoped(), attachment)
+}
+
+func (as *AttachmentService) remove(ctx context.Context, db *gorm.DB, attachment *entity.Attachment) error {
+	if err := db.Delete(attachment).Error; err != nil {
+		return err
+	}
+	var shared int64
+	if err := as.DB.Model(&entity.Attachment{}).Where("storage_key = ?", attachment.StorageKey).Count(&shared).Error; err != nil {
+		return err
+	}
+	if shared == 0 {
+		as.deleteBlobs(ctx, attachment)
+	}
+	return nil
+}
+
+func (as *AttachmentService) deleteBlobs(ctx context.Context, attachment *entity.Attachment) {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey, attachment.PreviewKey} {
+		if key == "" {
+			continue
+		}
+		if err := as.Store.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting blob %s: %v", key, err)
+		}
+	}
+}
+
+// newStorageKey returns a random key sharded by its first bytes, so local
+// directories stay small.
+func newStorageKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s/%s/%s", h[:2], h[2:4], h), nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
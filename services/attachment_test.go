@@ -0,0 +1,99 @@
+package services
+
+import (
+	"chat_app/entity"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestForwardedAttachmentsCopiedOnceStored(t *testing.T) {
+	ws := newTestService(t)
+	alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+	bob := createTestUser(t, ws.DB, "bob", entity.UserRoleUser)
+	original := entity.Attachment{UploaderID: bob.ID, MessageID: 1, StorageKey: "blob", FileName: "a.txt", Size: 100}
+	ws.DB.Create(&original)
+
+	later := time.Now().Add(time.Hour)
+	mutedIn := entity.Group{Name: "muted"}
+	openIn := entity.Group{Name: "open"}
+	ws.DB.Create(&mutedIn)
+	ws.DB.Create(&openIn)
+	ws.DB.Create(&entity.GroupMember{GroupID: mutedIn.ID, UserID: alice.ID, MutedUntil: &later})
+	ws.DB.Create(&entity.GroupMember{GroupID: openIn.ID, UserID: alice.ID})
+
+	forward := func(groupID uint) {
+		ws.Broadcast <- entity.Message{
+			SenderID:             alice.ID,
+			GroupID:              groupID,
+			Content:              "fwd",
+			Kind:                 entity.MessageKindText,
+			ForwardedAttachments: []entity.Attachment{original},
+		}
+	}
+	forward(mutedIn.ID)
+	forward(openIn.ID)
+
+	// handleMessages works through the queue in order, so once the second
+	// forward has its copy the first one was rejected
+	var copies []entity.Attachment
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ws.DB.Where("id <> ?", original.ID).Find(&copies)
+		if len(copies) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the forwarded attachment was not copied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var stored entity.Message
+	if err := ws.DB.Where("group_id = ?", openIn.ID).First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 1 || copies[0].MessageID != stored.ID || copies[0].StorageKey != original.StorageKey {
+		t.Fatalf("got copies %+v, want one linked to message %d", copies, stored.ID)
+	}
+
+	// The copy shares the blob, so it stays charged to bob, and only once
+	if copies[0].UploaderID != bob.ID {
+		t.Fatalf("copy is owned by user %d, want the original uploader %d", copies[0].UploaderID, bob.ID)
+	}
+	for _, user := range []entity.User{alice, bob} {
+		used, err := ws.Attachments.UsedBytes(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[uint]int64{alice.ID: 0, bob.ID: original.Size}[user.ID]; used != want {
+			t.Errorf("%s uses %d bytes, want %d", user.Username, used, want)
+		}
+	}
+}
+
+func TestStoreMessageLinksAttachmentOnce(t *testing.T) {
+	ws := newTestService(t)
+	alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+	group := entity.Group{Name: "group"}
+	ws.DB.Create(&group)
+	upload := entity.Attachment{UploaderID: alice.ID, StorageKey: "blob", FileName: "a.txt"}
+	ws.DB.Create(&upload)
+
+	// Two sends of the same upload can both pass Validate; only the first
+	// one is stored
+	first := entity.Message{SenderID: alice.ID, GroupID: group.ID, Content: "first", AttachmentIDs: []uint{upload.ID}}
+	if err := ws.storeMessage(&first); err != nil {
+		t.Fatal(err)
+	}
+	second := entity.Message{SenderID: alice.ID, GroupID: group.ID, Content: "second", AttachmentIDs: []uint{upload.ID}}
+	if err := ws.storeMessage(&second); !errors.Is(err, ErrAttachmentInvalid) {
+		t.Fatalf("got %v, want ErrAttachmentInvalid", err)
+	}
+
+	var contents []string
+	ws.DB.Model(&entity.Message{}).Pluck("content", &contents)
+	ws.DB.First(&upload, upload.ID)
+	if len(contents) != 1 || upload.MessageID != first.ID {
+		t.Fatalf("stored %v with the upload on message %d; want only the first", contents, upload.MessageID)
+	}
+}
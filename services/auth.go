@@ -1,6 +1,18 @@
 package services
 
-import "gorm.io/gorm"
+import (
+	"chat_app/entity"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrBotKey is returned when a bot acts without its valid API key.
+var ErrBotKey = errors.New("Bots must authenticate with their API key")
 
 type AuthService struct {
 	DB *gorm.DB
@@ -9,3 +21,36 @@ type AuthService struct {
 func NewAuthService(db *gorm.DB) *AuthService {
 	return &AuthService{DB: db}
 }
+
+// NewBotAPIKey returns a random bot API key and the hash that is stored.
+func NewBotAPIKey() (key, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = "bot_" + hex.EncodeToString(b)
+	return key, hashAPIKey(key), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyBot checks that a bot user is acting with its API key, passed as an
+// "Authorization: Bot <key>" header. Other users pass; bots without a key,
+// such as those of incoming webhooks, always fail.
+func (as *AuthService) VerifyBot(user *entity.User, authorization string) error {
+	if !user.IsBot() {
+		return nil
+	}
+	key, ok := strings.CutPrefix(authorization, "Bot ")
+	if !ok {
+		return ErrBotKey
+	}
+	var bot entity.Bot
+	if err := as.DB.Where("user_id = ? AND api_key_hash = ?", user.ID, hashAPIKey(key)).First(&bot).Error; err != nil {
+		return ErrBotKey
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"chat_app/entity"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+// commandPattern matches "/command", "/command@bot" and their arguments.
+var commandPattern = regexp.MustCompile(`(?s)^/([a-z0-9_-]+)(?:@([\w.-]+))?(?:\s+(.*))?$`)
+
+// routeCommand hands a slash command to the bot that registered it and
+// returns the ack for the invoker. In a group the bot must be a member and
+// the invoker must be allowed to post; in a direct conversation the bot must
+// be the receiver. Messages that name no
+// registered command are not handled and are sent as text.
+func (ws *WebSocketService) routeCommand(msg entity.Message) (map[string]interface{}, bool, error) {
+	match := commandPattern.FindStringSubmatch(msg.Content)
+	if match == nil {
+		return nil, false, nil
+	}
+	name, botName, args := match[1], match[2], match[3]
+
+	// Bots cannot invoke commands, so bots answering each other cannot loop
+	var sender entity.User
+	if err := ws.DB.Select("role").First(&sender, msg.SenderID).Error; err != nil || sender.IsBot() {
+		return nil, false, nil
+	}
+
+	query := ws.DB.Table("slash_commands").
+		Select("slash_commands.*").
+		Joins("JOIN users ON users.id = slash_commands.bot_user_id AND users.deleted_at IS NULL AND users.disabled_at IS NULL").
+		Where("slash_commands.command = ?", name)
+	if botName != "" {
+		query = query.Where("users.username = ?", botName)
+	}
+	if msg.GroupID != 0 {
+		query = query.Joins("JOIN group_members ON group_members.user_id = slash_commands.bot_user_id AND group_members.group_id = ? AND group_members.deleted_at IS NULL", msg.GroupID)
+	} else {
+		query = query.Where("slash_commands.bot_user_id = ?", msg.ReceiverID)
+	}
+	var commands []entity.SlashCommand
+	if err := query.Find(&commands).Error; err != nil {
+		log.Printf("Error resolving command /%s: %v", name, err)
+		return nil, true, errors.New("Error resolving command")
+	}
+	switch len(commands) {
+	case 0:
+		return nil, false, nil
+	case 1:
+	default:
+		return nil, true, fmt.Errorf("Several bots handle /%s; name one with /%s@bot", name, name)
+	}
+	command := commands[0]
+
+	// A command is a post in the conversation, so the sender must be
+	// allowed to post there
+	if err := ws.CheckPostable(msg); err != nil {
+		return nil, true, err
+	}
+
+	// A bot that never connected cannot receive the command; one that
+	// dropped gets it when it resumes
+	if !ws.hasSession(command.BotUserID) {
+		return nil, true, fmt.Errorf("The bot handling /%s is not connected", name)
+	}
+
+	invocation := entity.CommandInvocation{
+		BotUserID:  command.BotUserID,
+		Command:    name,
+		Args:       args,
+		UserID:     msg.SenderID,
+		GroupID:    msg.GroupID,
+		ReceiverID: msg.ReceiverID,
+	}
+	if err := ws.DB.Create(&invocation).Error; err != nil {
+		log.Printf("Error recording invocation of /%s: %v", name, err)
+		return nil, true, errors.New("Error sending command")
+	}
+	log.Printf("Routing /%s from user %d to bot %d (invocation %d)", name, msg.SenderID, command.BotUserID, invocation.ID)
+
+	ws.SendToUsers([]uint{command.BotUserID}, map[string]interface{}{
+		"event":         "command",
+		"invocation_id": invocation.ID,
+		"command":       name,
+		"args":          args,
+		"user_id":       msg.SenderID,
+		"group_id":      msg.GroupID,
+		"receiver_id":   msg.ReceiverID,
+	})
+	return map[string]interface{}{
+		"event":         "command_sent",
+		"invocation_id": invocation.ID,
+		"command":       name,
+		"bot_id":        command.BotUserID,
+		"client_msg_id": msg.ClientMsgID,
+	}, true, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"chat_app/entity"
+	"testing"
+	"time"
+)
+
+func TestRouteCommandChecksPostability(t *testing.T) {
+	ws := newTestService(t)
+	user := createTestUser(t, ws.DB, "user", entity.UserRoleUser)
+	bot := createTestUser(t, ws.DB, "deploybot", entity.UserRoleBot)
+	ws.DB.Create(&entity.SlashCommand{BotUserID: bot.ID, Command: "deploy"})
+	session, err := newSession(bot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.detachedAt = time.Now()
+	ws.Mutex.Lock()
+	ws.Sessions[session.Token] = session
+	ws.Mutex.Unlock()
+
+	later := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	for _, tt := range []struct {
+		name    string
+		group   entity.Group
+		member  entity.GroupMember
+		wantErr bool
+	}{
+		{"member", entity.Group{Type: entity.GroupTypeGroup}, entity.GroupMember{}, false},
+		{"muted member", entity.Group{Type: entity.GroupTypeGroup}, entity.GroupMember{MutedUntil: &later}, true},
+		{"archived group", entity.Group{Type: entity.GroupTypeGroup, ArchivedAt: &past}, entity.GroupMember{}, true},
+		{"channel subscriber", entity.Group{Type: entity.GroupTypeChannel}, entity.GroupMember{}, true},
+		{"channel admin", entity.Group{Type: entity.GroupTypeChannel}, entity.GroupMember{Role: entity.GroupRoleAdmin}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			group := tt.group
+			group.Name = tt.name
+			ws.DB.Create(&group)
+			ws.DB.Create(&entity.GroupMember{GroupID: group.ID, UserID: bot.ID})
+			member := tt.member
+			member.GroupID, member.UserID = group.ID, user.ID
+			ws.DB.Create(&member)
+
+			ack, err := ws.SubmitMessage(user.ID, entity.Message{GroupID: group.ID, Content: "/deploy staging"})
+			var invocations int64
+			ws.DB.Model(&entity.CommandInvocation{}).Where("group_id = ?", group.ID).Count(&invocations)
+			if tt.wantErr {
+				if err == nil || invocations != 0 {
+					t.Fatalf("got ack %v, error %v and %d invocations; want a rejection", ack, err, invocations)
+				}
+				return
+			}
+			if err != nil || ack["event"] != "command_sent" || invocations != 1 {
+				t.Fatalf("got ack %v, error %v and %d invocations; want the command routed", ack, err, invocations)
+			}
+		})
+	}
+}
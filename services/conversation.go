@@ -0,0 +1,49 @@
+package services
+
+import (
+	"chat_app/entity"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindConversation returns the conversation of a group (groupID) or of the
+// direct pair of userID and peerID, or nil if no message was sent there yet.
+func (ms *MessageService) FindConversation(userID, groupID, peerID uint) (*entity.Conversation, error) {
+	key := entity.Conversation{GroupID: groupID}
+	if groupID == 0 {
+		key = entity.DirectConversation(userID, peerID)
+	}
+	var conversation entity.Conversation
+	err := ms.DB.Where("group_id = ? AND low_user_id = ? AND high_user_id = ?", key.GroupID, key.LowUserID, key.HighUserID).
+		First(&conversation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// EnsureDirectConversation returns the direct conversation of two users,
+// creating it with its participants if needed, e.g. to store a setting
+// before the first message.
+func (ms *MessageService) EnsureDirectConversation(userID, peerID uint) (*entity.Conversation, error) {
+	conversation := entity.DirectConversation(userID, peerID)
+	err := ms.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&conversation).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = 0 AND low_user_id = ? AND high_user_id = ?", conversation.LowUserID, conversation.HighUserID).
+			First(&conversation).Error; err != nil {
+			return err
+		}
+		return addParticipants(tx, &conversation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
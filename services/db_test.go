@@ -0,0 +1,69 @@
+package services
+
+import (
+	"chat_app/config"
+	"chat_app/db"
+	"chat_app/entity"
+	"chat_app/storage"
+	"database/sql/driver"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var registerSQLFunctions sync.Once
+
+// newTestDB returns a migrated SQLite database private to the test. SQLite
+// stands in for Postgres, so tests only cover queries both understand; the
+// NOW() used by raw statements is provided here.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	registerSQLFunctions.Do(func() {
+		gosqlite.MustRegisterScalarFunction("now", 0, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+			return time.Now().UTC().Format("2006-01-02 15:04:05.999999999-07:00"), nil
+		})
+	})
+
+	dsn := filepath.Join(t.TempDir(), "chat.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	database, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	if err := database.AutoMigrate(db.Models...); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return database
+}
+
+// newTestService wires a WebSocketService to a test database and a local
+// blob store, as main does with the real ones.
+func newTestService(t *testing.T) *WebSocketService {
+	t.Helper()
+	database := newTestDB(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating blob store: %v", err)
+	}
+	cfg := &config.Config{MaxUploadBytes: 1 << 20, UserQuotaBytes: 10 << 20}
+	return NewWebSocketService(database, NewAttachmentService(database, store, cfg), NewWebhookService(database), NewMessageService(database))
+}
+
+func createTestUser(t *testing.T, database *gorm.DB, username, role string) entity.User {
+	t.Helper()
+	user := entity.User{Username: username, Role: role}
+	if err := database.Create(&user).Error; err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user
+}
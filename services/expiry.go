@@ -0,0 +1,75 @@
+package services
+
+import (
+	"chat_app/entity"
+	"context"
+	"log"
+	"time"
+)
+
+// expiryBatchSize bounds how many expired messages one tick deletes, so a
+// large backlog is worked off gradually.
+const expiryBatchSize = 500
+
+// deleteExpiredMessages hard-deletes messages whose disappearing timer ran
+// out, together with their attachments, reactions, pins, stars and
+// mentions, and tells connected participants to remove them.
+func (ss *SchedulerService) deleteExpiredMessages() {
+	var messages []entity.Message
+	if err := ss.DB.Unscoped().Where("expires_at <= ?", time.Now().UTC()).
+		Order("expires_at").Limit(expiryBatchSize).Find(&messages).Error; err != nil {
+		log.Printf("Error fetching expired messages: %v", err)
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	var attachments []entity.Attachment
+	if err := ss.DB.Unscoped().Where("message_id IN ?", ids).Find(&attachments).Error; err != nil {
+		log.Printf("Error fetching attachments of expired messages: %v", err)
+		return
+	}
+	for i := range attachments {
+		if err := ss.WebSocketService.Attachments.Purge(context.Background(), &attachments[i]); err != nil {
+			log.Printf("Error deleting attachment %d: %v", attachments[i].ID, err)
+		}
+	}
+
+	for _, model := range []interface{}{&entity.MessageReaction{}, &entity.PinnedMessage{}, &entity.StarredMessage{}, &entity.Mention{}} {
+		if err := ss.DB.Where("message_id IN ?", ids).Delete(model).Error; err != nil {
+			log.Printf("Error deleting %T rows of expired messages: %v", model, err)
+		}
+	}
+	if err := ss.DB.Unscoped().Where("id IN ?", ids).Delete(&entity.Message{}).Error; err != nil {
+		log.Printf("Error deleting expired messages: %v", err)
+		return
+	}
+	log.Printf("Deleted %d expired messages", len(messages))
+
+	members := make(map[uint][]uint) // Group members, fetched once per group
+	for _, msg := range messages {
+		audience := []uint{msg.SenderID, msg.ReceiverID}
+		if msg.GroupID != 0 {
+			if _, ok := members[msg.GroupID]; !ok {
+				var userIDs []uint
+				ss.DB.Model(&entity.GroupMember{}).Where("group_id = ?", msg.GroupID).Pluck("user_id", &userIDs)
+				members[msg.GroupID] = userIDs
+			}
+			audience = members[msg.GroupID]
+		}
+		ss.WebSocketService.SendToUsers(audience, map[string]interface{}{
+			"event":       "message_deleted",
+			"reason":      "expired",
+			"message_id":  msg.ID,
+			"group_id":    msg.GroupID,
+			"sender_id":   msg.SenderID,
+			"receiver_id": msg.ReceiverID,
+		})
+	}
+}
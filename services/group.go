@@ -1,6 +1,11 @@
 package services
 
-import "gorm.io/gorm"
+import (
+	"chat_app/entity"
+	"log"
+
+	"gorm.io/gorm"
+)
 
 type GroupService struct {
 	DB *gorm.DB
@@ -9,3 +14,82 @@ type GroupService struct {
 func NewGroupService(db *gorm.DB) *GroupService {
 	return &GroupService{DB: db}
 }
+
+// GetMember returns the active membership of a user in a group.
+// It returns gorm.ErrRecordNotFound if the user is not a member.
+func (gs *GroupService) GetMember(groupID, userID uint) (*entity.GroupMember, error) {
+	var member entity.GroupMember
+	if err := gs.DB.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", groupID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// IsAdmin reports whether the user is an owner or admin of the group.
+func (gs *GroupService) IsAdmin(groupID, userID uint) bool {
+	member, err := gs.GetMember(groupID, userID)
+	if err != nil {
+		return false
+	}
+	return member.IsAdmin()
+}
+
+// AdminIDs returns the user IDs of the group's owners and admins.
+func (gs *GroupService) AdminIDs(groupID uint) ([]uint, error) {
+	var ids []uint
+	err := gs.DB.Model(&entity.GroupMember{}).
+		Where("group_id = ? AND role IN ? AND deleted_at IS NULL", groupID, []string{entity.GroupRoleOwner, entity.GroupRoleAdmin}).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// MemberIDs returns the user IDs of all active members of the group.
+func (gs *GroupService) MemberIDs(groupID uint) ([]uint, error) {
+	var ids []uint
+	err := gs.DB.Model(&entity.GroupMember{}).
+		Where("group_id = ? AND deleted_at IS NULL", groupID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// DeleteGroup soft-deletes a group together with its memberships, invites
+// and join requests, and optionally its message history.
+func (gs *GroupService) DeleteGroup(groupID uint, deleteMessages bool) error {
+	return gs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&entity.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&entity.GroupInvite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&entity.GroupJoinRequest{}).Error; err != nil {
+			return err
+		}
+		if deleteMessages {
+			if err := tx.Where("group_id = ?", groupID).Delete(&entity.Message{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&entity.Group{}, groupID).Error
+	})
+}
+
+// IsBanned reports whether the user is banned from the group.
+func (gs *GroupService) IsBanned(groupID, userID uint) bool {
+	var ban entity.GroupBan
+	return gs.DB.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", groupID, userID).First(&ban).Error == nil
+}
+
+// LogModeration appends an entry to the group's audit log.
+func (gs *GroupService) LogModeration(groupID, actorID uint, action string, targetUserID uint, details string) {
+	entry := entity.GroupAuditLog{
+		GroupID:      groupID,
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Details:      details,
+	}
+	if err := gs.DB.Create(&entry).Error; err != nil {
+		log.Printf("Error writing audit log for group %d: %v", groupID, err)
+	}
+}
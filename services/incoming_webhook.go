@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"chat_app/entity"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// IncomingWebhookRateLimit is how many messages an incoming webhook may
+	// post per incomingWebhookWindow.
+	IncomingWebhookRateLimit = 20
+	incomingWebhookWindow    = time.Minute
+)
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// AllowIncoming counts a post to an incoming webhook against its rate
+// limit. Over the limit it returns false and the time until the next window.
+func (s *WebhookService) AllowIncoming(webhookID uint) (bool, time.Duration) {
+	s.limitMu.Lock()
+	defer s.limitMu.Unlock()
+	now := time.Now()
+	window, ok := s.limits[webhookID]
+	if !ok || now.Sub(window.start) >= incomingWebhookWindow {
+		window = &rateWindow{start: now}
+		s.limits[webhookID] = window
+	}
+	if window.count >= IncomingWebhookRateLimit {
+		return false, window.start.Add(incomingWebhookWindow).Sub(now)
+	}
+	window.count++
+	return true, 0
+}
+
+// CreateIncoming stores an incoming webhook together with its bot user and
+// adds the bot to the group. Bots join channels as admins, since only admins
+// post there. The optional callback URL receives interactions with the
+// bot's messages.
+func (s *WebhookService) CreateIncoming(group *entity.Group, name, token, callbackURL string, createdBy uint) (*entity.IncomingWebhook, *entity.User, error) {
+	webhook := &entity.IncomingWebhook{
+		GroupID:     group.ID,
+		Name:        name,
+		Token:       token,
+		CallbackURL: callbackURL,
+		CreatedBy:   createdBy,
+	}
+	bot := &entity.User{Role: entity.UserRoleBot}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(webhook).Error; err != nil {
+			return err
+		}
+		// Usernames are unique; the suffix keeps bots of the same name apart
+		bot.Username = fmt.Sprintf("%s-bot-%d", name, webhook.ID)
+		if err := tx.Create(bot).Error; err != nil {
+			return err
+		}
+		role := entity.GroupRoleMember
+		if group.Type == entity.GroupTypeChannel {
+			role = entity.GroupRoleAdmin
+		}
+		if err := tx.Create(&entity.GroupMember{GroupID: group.ID, UserID: bot.ID, Role: role}).Error; err != nil {
+			return err
+		}
+		webhook.BotUserID = bot.ID
+		return tx.Model(webhook).Update("bot_user_id", bot.ID).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return webhook, bot, nil
+}
+
+// RevokeIncoming stops an incoming webhook: the URL stops working, and its
+// bot leaves the group and is disabled.
+func (s *WebhookService) RevokeIncoming(webhook *entity.IncomingWebhook) error {
+	now := time.Now().UTC()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(webhook).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		var member entity.GroupMember
+		if err := tx.Where("group_id = ? AND user_id = ?", webhook.GroupID, webhook.BotUserID).First(&member).Error; err == nil {
+			if err := tx.Delete(&member).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&entity.User{}).Where("id = ?", webhook.BotUserID).Update("disabled_at", now).Error
+	})
+}
+
+// PostInteraction sends an interaction with a webhook bot's message to the
+// webhook's callback URL, signed with the webhook's token as the secret. A
+// 2xx response may carry an InteractionResponse; an empty body means the
+// integration has nothing to update.
+func (s *WebhookService) PostInteraction(webhook entity.IncomingWebhook, interaction entity.MessageInteraction, event map[string]interface{}) (*InteractionResponse, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", "interaction")
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(interaction.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(webhook.Token, timestamp, payload))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	var answer InteractionResponse
+	if err := json.Unmarshal(body, &answer); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &answer, nil
+}
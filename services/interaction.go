@@ -0,0 +1,268 @@
+package services
+
+import (
+	"chat_app/entity"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// InteractionRequest is a click on a button, a choice in a select menu or a
+// form submission, sent by a client as {"interaction": {...}}.
+type InteractionRequest struct {
+	MessageID uint              `json:"message_id"`
+	ActionID  string            `json:"action_id"`        // A form's block_id for submissions
+	Value     string            `json:"value,omitempty"`  // The chosen option of a select menu
+	Values    map[string]string `json:"values,omitempty"` // Form fields by action_id
+}
+
+// MessageUpdate replaces parts of an interactive message in place. Blocks
+// are replaced when set; an empty list removes them.
+type MessageUpdate struct {
+	Content *string       `json:"content"`
+	Format  string        `json:"format"`
+	Blocks  entity.Blocks `json:"blocks"`
+}
+
+// InteractionResponse is how a bot answers an interaction: by updating the
+// message, by replying to the user who interacted only, or both.
+type InteractionResponse struct {
+	Update *MessageUpdate `json:"update"`
+	Reply  string         `json:"reply"`
+	Format string         `json:"format"` // Of the reply
+}
+
+var (
+	// ErrInteractionGone is returned when the message of an interaction
+	// was deleted before the bot answered.
+	ErrInteractionGone = errors.New("The message no longer exists")
+	// ErrUpdateFailed is returned when a valid update could not be stored.
+	ErrUpdateFailed = errors.New("Error updating message")
+)
+
+// HandleInteraction validates an interaction against the blocks of its
+// message and hands it to the message's sender: a bot with an API key
+// receives an "interaction" event, an incoming webhook with a callback URL a
+// signed POST whose response is applied. It returns the ack for the user.
+func (ws *WebSocketService) HandleInteraction(userID uint, req InteractionRequest) (map[string]interface{}, error) {
+	var msg entity.Message
+	if err := ws.DB.First(&msg, req.MessageID).Error; err != nil || !ws.Messages.CanAccess(userID, &msg) {
+		return nil, errors.New("Message not found")
+	}
+	if msg.ScheduledTime != nil && !msg.Sent {
+		return nil, errors.New("Message not found")
+	}
+	values, err := interactionValues(msg.Blocks, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var user, bot entity.User
+	if err := ws.DB.Select("role").First(&user, userID).Error; err != nil || user.IsBot() {
+		return nil, errors.New("Bots cannot interact with messages")
+	}
+	if err := ws.DB.First(&bot, msg.SenderID).Error; err != nil || bot.DisabledAt != nil {
+		return nil, errors.New("The bot that sent this message is no longer available")
+	}
+
+	var hook *entity.IncomingWebhook
+	var apiBot entity.Bot
+	if err := ws.DB.Where("user_id = ?", bot.ID).First(&apiBot).Error; err == nil {
+		if !ws.hasSession(bot.ID) {
+			return nil, errors.New("The bot that sent this message is not connected")
+		}
+	} else {
+		var webhook entity.IncomingWebhook
+		if err := ws.DB.Where("bot_user_id = ? AND revoked_at IS NULL AND callback_url <> ''", bot.ID).First(&webhook).Error; err != nil {
+			return nil, errors.New("This message does not accept interactions")
+		}
+		hook = &webhook
+	}
+
+	interaction := entity.MessageInteraction{
+		MessageID: msg.ID,
+		UserID:    userID,
+		BotUserID: bot.ID,
+		ActionID:  req.ActionID,
+	}
+	if err := ws.DB.Create(&interaction).Error; err != nil {
+		log.Printf("Error recording interaction with message %d: %v", msg.ID, err)
+		return nil, errors.New("Error sending interaction")
+	}
+	log.Printf("Routing interaction %s on message %d from user %d to bot %d (interaction %d)", req.ActionID, msg.ID, userID, bot.ID, interaction.ID)
+
+	event := map[string]interface{}{
+		"event":          "interaction",
+		"interaction_id": interaction.ID,
+		"message_id":     msg.ID,
+		"action_id":      req.ActionID,
+		"value":          values[req.ActionID],
+		"values":         values,
+		"user_id":        userID,
+		"group_id":       msg.GroupID,
+		"receiver_id":    msg.ReceiverID,
+	}
+	if hook == nil {
+		ws.SendToUsers([]uint{bot.ID}, event)
+	} else {
+		go ws.callInteractionHook(*hook, interaction, event)
+	}
+
+	return map[string]interface{}{
+		"event":          "interaction_sent",
+		"interaction_id": interaction.ID,
+		"message_id":     msg.ID,
+		"action_id":      req.ActionID,
+	}, nil
+}
+
+// interactionValues checks that an interaction names an element of the
+// message and returns what the user chose, keyed by action ID. Buttons
+// submit their own value, never the client's.
+func interactionValues(blocks entity.Blocks, req InteractionRequest) (map[string]string, error) {
+	block, element := blocks.Find(req.ActionID)
+	if block == nil {
+		return nil, errors.New("Unknown action")
+	}
+	if element != nil {
+		switch element.Type {
+		case entity.ElementButton:
+			return map[string]string{element.ActionID: element.Value}, nil
+		case entity.ElementSelect:
+			if !element.HasOption(req.Value) {
+				return nil, errors.New("Invalid option")
+			}
+			return map[string]string{element.ActionID: req.Value}, nil
+		}
+		return nil, errors.New("Unknown action")
+	}
+
+	values := make(map[string]string, len(block.Elements))
+	for _, field := range block.Elements {
+		value := req.Values[field.ActionID]
+		if value == "" {
+			if field.Required {
+				return nil, fmt.Errorf("%s is required", fieldName(field))
+			}
+			continue
+		}
+		if field.Type == entity.ElementSelect && !field.HasOption(value) {
+			return nil, fmt.Errorf("Invalid option for %s", fieldName(field))
+		}
+		values[field.ActionID] = value
+	}
+	for key := range req.Values {
+		if _, ok := values[key]; !ok && req.Values[key] != "" {
+			return nil, fmt.Errorf("Unknown form field %q", key)
+		}
+	}
+	return values, nil
+}
+
+func fieldName(e entity.Element) string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.ActionID
+}
+
+// callInteractionHook posts an interaction to an incoming webhook's
+// callback URL and applies the answer. Failures are reported to the user.
+func (ws *WebSocketService) callInteractionHook(webhook entity.IncomingWebhook, interaction entity.MessageInteraction, event map[string]interface{}) {
+	resp, err := ws.Webhooks.PostInteraction(webhook, interaction, event)
+	if err != nil {
+		log.Printf("Error posting interaction %d to incoming webhook %d: %v", interaction.ID, webhook.ID, err)
+		ws.sendError(interaction.UserID, "The integration did not handle the interaction")
+		return
+	}
+	if resp == nil || (resp.Update == nil && resp.Reply == "") {
+		return
+	}
+	if err := ws.RespondToInteraction(interaction, *resp); err != nil {
+		log.Printf("Error applying response of incoming webhook %d to interaction %d: %v", webhook.ID, interaction.ID, err)
+		ws.sendError(interaction.UserID, "The integration sent an invalid response")
+	}
+}
+
+// RespondToInteraction applies a bot's answer: the message is updated in
+// place for everyone who can see it, and the reply goes to the user who
+// interacted only. Errors are meant for the bot.
+func (ws *WebSocketService) RespondToInteraction(interaction entity.MessageInteraction, resp InteractionResponse) error {
+	if resp.Update == nil && resp.Reply == "" {
+		return errors.New("A response needs an update or a reply")
+	}
+	if resp.Format == "" {
+		resp.Format = entity.MessageFormatPlain
+	}
+	if resp.Format != entity.MessageFormatPlain && resp.Format != entity.MessageFormatMarkdown {
+		return errors.New("Format must be plain or markdown")
+	}
+
+	if update := resp.Update; update != nil {
+		var msg entity.Message
+		if err := ws.DB.First(&msg, interaction.MessageID).Error; err != nil {
+			return ErrInteractionGone
+		}
+		changes := map[string]interface{}{}
+		if update.Content != nil {
+			msg.Content = *update.Content
+			changes["content"] = msg.Content
+		}
+		if update.Format != "" {
+			if update.Format != entity.MessageFormatPlain && update.Format != entity.MessageFormatMarkdown {
+				return errors.New("Format must be plain or markdown")
+			}
+			msg.Format = update.Format
+			changes["format"] = msg.Format
+		}
+		if update.Blocks != nil {
+			if err := update.Blocks.Validate(); err != nil {
+				return err
+			}
+			msg.Blocks = update.Blocks
+			changes["blocks"] = msg.Blocks
+		}
+		if len(changes) == 0 {
+			return errors.New("The update changes nothing")
+		}
+		if err := ws.DB.Model(&msg).Updates(changes).Error; err != nil {
+			log.Printf("Error updating message %d after interaction %d: %v", msg.ID, interaction.ID, err)
+			return ErrUpdateFailed
+		}
+
+		audience, err := ws.Messages.Audience(&msg)
+		if err != nil {
+			log.Printf("Error resolving audience of message %d: %v", msg.ID, err)
+		}
+		ws.SendToUsers(audience, map[string]interface{}{
+			"event":          "message_updated",
+			"interaction_id": interaction.ID,
+			"message":        msg,
+		})
+	}
+
+	if resp.Reply != "" {
+		ws.SendToUsers([]uint{interaction.UserID}, map[string]interface{}{
+			"event":          "interaction_response",
+			"interaction_id": interaction.ID,
+			"message_id":     interaction.MessageID,
+			"bot_id":         interaction.BotUserID,
+			"content":        resp.Reply,
+			"format":         resp.Format,
+		})
+	}
+	return nil
+}
+
+// hasSession reports whether a user has a session, connected or waiting to
+// be resumed, that can receive frames.
+func (ws *WebSocketService) hasSession(userID uint) bool {
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	for _, session := range ws.Sessions {
+		if session.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultPollTimeout is how long a poll waits for frames.
+	defaultPollTimeout = 25 * time.Second
+	// maxPollTimeout stays well below ResumeGracePeriod, so a session
+	// outlives the gap between two polls.
+	maxPollTimeout = 55 * time.Second
+)
+
+// pollConn attaches a session for the duration of one long-poll request and
+// collects the frames written to it.
+type pollConn struct {
+	ctx       context.Context
+	timeout   time.Duration
+	mu        sync.Mutex
+	frames    []json.RawMessage
+	readyOnce sync.Once
+	ready     chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// ReadJSON waits until there is something to return to the client. Polls
+// receive no frames from the client; they send through the REST API.
+func (c *pollConn) ReadJSON(v interface{}) error {
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case <-c.ready:
+	case <-c.closed:
+	case <-timer.C:
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+	return errTransportClosed
+}
+
+func (c *pollConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// WriteMessage collects a frame. The greeting alone only ends the poll when
+// it opens a new session, since the client has to sync then; otherwise the
+// poll waits for a frame after it.
+func (c *pollConn) WriteMessage(_ int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, append(json.RawMessage(nil), data...))
+	if len(c.frames) == 1 {
+		var welcome struct {
+			Resumed bool `json:"resumed"`
+		}
+		if json.Unmarshal(data, &welcome); welcome.Resumed {
+			return nil
+		}
+	}
+	c.readyOnce.Do(func() { close(c.ready) })
+	return nil
+}
+
+func (c *pollConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// Poll serves one long-poll request: it resumes the session named by the
+// resume_token and last_seq query parameters, waits up to timeout seconds
+// for frames and returns them. The first frame is the greeting, which
+// carries the resume_token for the next poll; last_seq is the highest
+// session_seq received so far.
+func (ws *WebSocketService) Poll(w http.ResponseWriter, r *http.Request, userID uint) {
+	query := r.URL.Query()
+	timeout := defaultPollTimeout
+	if param := query.Get("timeout"); param != "" {
+		seconds, err := strconv.Atoi(param)
+		if err != nil || seconds < 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(seconds)*time.Second, maxPollTimeout)
+	}
+
+	conn := &pollConn{
+		ctx:     r.Context(),
+		timeout: timeout,
+		ready:   make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	ws.Serve(conn, userID, query.Get("resume_token"), query.Get("last_seq"))
+
+	// Serve has detached the session, so no more frames are collected;
+	// frames that missed this poll are replayed by the next one
+	conn.mu.Lock()
+	frames := conn.frames
+	conn.mu.Unlock()
+	if r.Context().Err() != nil {
+		return
+	}
+	if len(frames) == 0 {
+		http.Error(w, "Error creating session", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Long poll for user %d returning %d frames", userID, len(frames))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"frames": frames,
+	})
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"chat_app/entity"
+	"regexp"
+	"strings"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// MaxGroupMentionMembers is the largest group in which @all and @here may be
+// used. Each mentioned member gets a Mention row and an event while the
+// message is sent, which larger groups and channels would hold up.
+const MaxGroupMentionMembers = 500
+
+// ParseMentions extracts the mentioned usernames from message content.
+// @all and @here are reported separately and not included in usernames.
+func ParseMentions(content string) (usernames []string, all, here bool) {
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		switch strings.ToLower(name) {
+		case "all", "everyone":
+			all = true
+		case "here":
+			here = true
+		default:
+			if name != "" && !seen[name] {
+				seen[name] = true
+				usernames = append(usernames, name)
+			}
+		}
+	}
+	return usernames, all, here
+}
+
+// resolveMentions stores a Mention row for every active member of the
+// group mentioned by the message and returns their user IDs. The sender and
+// members who blocked the sender are skipped.
+func (ws *WebSocketService) resolveMentions(msg entity.Message) ([]uint, error) {
+	usernames, all, here := ParseMentions(msg.Content)
+	if len(usernames) == 0 && !all && !here {
+		return nil, nil
+	}
+
+	var members []struct {
+		UserID   uint
+		Username string
+	}
+	err := ws.DB.Table("group_members").
+		Select("group_members.user_id, users.username").
+		Joins("JOIN users ON users.id = group_members.user_id AND users.deleted_at IS NULL").
+		Where("group_members.group_id = ? AND group_members.deleted_at IS NULL AND group_members.user_id <> ?", msg.GroupID, msg.SenderID).
+		Where("group_members.user_id NOT IN (?)", ws.DB.Model(&entity.BlockedUser{}).Select("user_id").Where("blocked_id = ?", msg.SenderID)).
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	named := make(map[string]bool, len(usernames))
+	for _, name := range usernames {
+		named[name] = true
+	}
+	var online map[uint]bool
+	if here && !all {
+		online = ws.onlineUsers()
+	}
+
+	var mentions []entity.Mention
+	var userIDs []uint
+	for _, member := range members {
+		kind := ""
+		switch {
+		case named[member.Username]:
+			kind = entity.MentionUser
+		case all:
+			kind = entity.MentionAll
+		case here && online[member.UserID]:
+			kind = entity.MentionHere
+		default:
+			continue
+		}
+		mentions = append(mentions, entity.Mention{
+			MessageID: msg.ID,
+			GroupID:   msg.GroupID,
+			SenderID:  msg.SenderID,
+			UserID:    member.UserID,
+			Kind:      kind,
+		})
+		userIDs = append(userIDs, member.UserID)
+	}
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	if err := ws.DB.CreateInBatches(&mentions, 500).Error; err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// onlineUsers returns the set of users with at least one open connection.
+func (ws *WebSocketService) onlineUsers() map[uint]bool {
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	online := make(map[uint]bool, len(ws.Clients))
+	for client := range ws.Clients {
+		online[client.UserID] = true
+	}
+	return online
+}
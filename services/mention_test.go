@@ -0,0 +1,31 @@
+package services
+
+import (
+	"chat_app/entity"
+	"testing"
+)
+
+func TestGroupMentionsAreLimitedInLargeGroups(t *testing.T) {
+	ws := newTestService(t)
+	alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+	group := entity.Group{Name: "crowd"}
+	ws.DB.Create(&group)
+	ws.DB.Create(&entity.GroupMember{GroupID: group.ID, UserID: alice.ID, Role: entity.GroupRoleOwner})
+
+	post := func(content string) error {
+		return ws.CheckPostable(entity.Message{SenderID: alice.ID, GroupID: group.ID, Content: content, Kind: entity.MessageKindText})
+	}
+	if err := post("hello @all"); err != nil {
+		t.Fatalf("@all in a small group: %v", err)
+	}
+
+	ws.DB.Model(&group).Update("member_count", MaxGroupMentionMembers+1)
+	for _, content := range []string{"hello @all", "anyone @here?"} {
+		if err := post(content); err == nil {
+			t.Errorf("%q was allowed in a large group", content)
+		}
+	}
+	if err := post("hello @alice"); err != nil {
+		t.Fatalf("a plain mention in a large group: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"chat_app/entity"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MessageService struct {
+	DB *gorm.DB
+}
+
+func NewMessageService(db *gorm.DB) *MessageService {
+	return &MessageService{DB: db}
+}
+
+// CanAccess reports whether the user may see the message: a participant of
+// a direct message, or an active member of the group it was posted to.
+// Scheduled messages are only visible to their sender until they are sent,
+// and expired messages to no one.
+func (ms *MessageService) CanAccess(userID uint, msg *entity.Message) bool {
+	if msg.ScheduledTime != nil && !msg.Sent && msg.SenderID != userID {
+		return false
+	}
+	if msg.ExpiresAt != nil && !msg.ExpiresAt.After(time.Now()) {
+		return false
+	}
+	if msg.GroupID != 0 {
+		var member entity.GroupMember
+		return ms.DB.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", msg.GroupID, userID).First(&member).Error == nil
+	}
+	if msg.ReceiverID != 0 {
+		return msg.SenderID == userID || msg.ReceiverID == userID
+	}
+	// Server-wide broadcasts are visible to everyone
+	return msg.Kind == entity.MessageKindSystem
+}
+
+// Audience returns the users who should receive live updates about a message.
+func (ms *MessageService) Audience(msg *entity.Message) ([]uint, error) {
+	if msg.GroupID != 0 {
+		var ids []uint
+		err := ms.DB.Model(&entity.GroupMember{}).
+			Where("group_id = ? AND deleted_at IS NULL", msg.GroupID).
+			Pluck("user_id", &ids).Error
+		return ids, err
+	}
+	return []uint{msg.SenderID, msg.ReceiverID}, nil
+}
+
+// SearchParams narrows a full-text message search.
+type SearchParams struct {
+	UserID   uint   // The caller; results are limited to what they can see
+	Query    string // websearch syntax: words, "quoted phrases", -exclusions, OR
+	SenderID uint
+	GroupID  uint
+	PeerID   uint // Direct messages between the caller and this user
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	PageSize int
+}
+
+// SearchResult is a matching message with a highlighted snippet.
+type SearchResult struct {
+	entity.Message
+	Snippet string  `json:"snippet"` // HTML: the escaped content with <mark> around matches
+	Rank    float64 `json:"rank"`
+}
+
+// searchConfig is the Postgres text search configuration; it must match the
+// expression of the idx_messages_content_fts index.
+const searchConfig = "english"
+
+// escapedContent is the message content with HTML special characters
+// escaped, so the <mark> tags ts_headline adds are the only markup in a
+// snippet. The text search parser reads the entities as single tokens.
+const escapedContent = `replace(replace(replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+
+// Search runs a full-text search over the messages the caller can see: their
+// own direct messages, and group messages sent while they were a member.
+// Deleted and expired messages and messages from users the caller blocked
+// are excluded.
+func (ms *MessageService) Search(p SearchParams) ([]SearchResult, int64, error) {
+	query := ms.DB.Model(&entity.Message{}).
+		Where("to_tsvector('"+searchConfig+"', content) @@ websearch_to_tsquery('"+searchConfig+"', @q)", sql.Named("q", p.Query)).
+		Where("kind = ?", entity.MessageKindText).
+		Where("scheduled_time IS NULL OR sent = ? OR sender_id = ?", true, p.UserID).
+		Where("group_id <> 0 OR sender_id = @user OR receiver_id = @user", sql.Named("user", p.UserID)).
+		Scopes(ms.SentWhileMember(p.UserID), ms.NotExpired(), ms.NotBlockedBy(p.UserID))
+
+	if p.SenderID != 0 {
+		query = query.Where("sender_id = ?", p.SenderID)
+	}
+	if p.GroupID != 0 {
+		query = query.Where("group_id = ?", p.GroupID)
+	}
+	if p.PeerID != 0 {
+		query = query.Where("group_id = 0 AND ((sender_id = @user AND receiver_id = @peer) OR (sender_id = @peer AND receiver_id = @user))",
+			sql.Named("user", p.UserID), sql.Named("peer", p.PeerID))
+	}
+	if p.From != nil {
+		query = query.Where("created_at >= ?", *p.From)
+	}
+	if p.To != nil {
+		query = query.Where("created_at < ?", *p.To)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	results := []SearchResult{}
+	err := query.
+		Select(`messages.*,
+			ts_headline('`+searchConfig+`', `+escapedContent+`, websearch_to_tsquery('`+searchConfig+`', @q),
+				'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet,
+			ts_rank(to_tsvector('`+searchConfig+`', content), websearch_to_tsquery('`+searchConfig+`', @q)) AS rank`,
+			sql.Named("q", p.Query)).
+		Order("rank DESC, created_at DESC").
+		Limit(p.PageSize).
+		Offset((p.Page - 1) * p.PageSize).
+		Scan(&results).Error
+	return results, total, err
+}
+
+// VisibleTo is a scope limiting a messages query to what the user can see
+// now: their direct messages and messages of groups they are a member of,
+// but not others' scheduled messages that are still pending, nor expired
+// messages the sweep has yet to delete. Deleted messages are already
+// excluded by the soft-delete condition.
+func (ms *MessageService) VisibleTo(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(messages.group_id = 0 AND (messages.sender_id = @user OR messages.receiver_id = @user)) OR
+			(messages.group_id <> 0 AND EXISTS (
+				SELECT 1 FROM group_members gm
+				WHERE gm.group_id = messages.group_id AND gm.user_id = @user AND gm.deleted_at IS NULL))`, sql.Named("user", userID)).
+			Where("messages.scheduled_time IS NULL OR messages.sent = ? OR messages.sender_id = ?", true, userID).
+			Scopes(ms.NotExpired())
+	}
+}
+
+// SentWhileMember is a scope limiting group messages to those sent while
+// the user was a member of the group, so joining does not reveal earlier
+// history. Direct messages pass through.
+func (ms *MessageService) SentWhileMember(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`messages.group_id = 0 OR EXISTS (
+			SELECT 1 FROM group_members gm
+			WHERE gm.group_id = messages.group_id AND gm.user_id = ?
+			AND gm.created_at <= messages.created_at
+			AND (gm.deleted_at IS NULL OR gm.deleted_at > messages.created_at))`, userID)
+	}
+}
+
+// NotExpired is a scope dropping disappearing messages whose time is up but
+// which the expiry sweep has not deleted yet.
+func (ms *MessageService) NotExpired() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("messages.expires_at IS NULL OR messages.expires_at > ?", time.Now().UTC())
+	}
+}
+
+// NotBlockedBy is a scope dropping messages from senders the user blocked,
+// which live delivery never sent them either.
+func (ms *MessageService) NotBlockedBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("messages.sender_id NOT IN (?)", ms.DB.Model(&entity.BlockedUser{}).Select("blocked_id").Where("user_id = ?", userID))
+	}
+}
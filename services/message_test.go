@@ -0,0 +1,106 @@
+package services
+
+import (
+	"chat_app/entity"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCanAccessScheduledMessage(t *testing.T) {
+	database := newTestDB(t)
+	ms := NewMessageService(database)
+	alice := createTestUser(t, database, "alice", entity.UserRoleUser)
+	bob := createTestUser(t, database, "bob", entity.UserRoleUser)
+	carol := createTestUser(t, database, "carol", entity.UserRoleUser)
+
+	later := time.Now().Add(time.Hour)
+	msg := entity.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "soon", ScheduledTime: &later}
+	if err := database.Create(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	visible := func(userID uint) (bool, bool) {
+		var count int64
+		database.Model(&entity.Message{}).Scopes(ms.VisibleTo(userID)).Where("messages.id = ?", msg.ID).Count(&count)
+		return ms.CanAccess(userID, &msg), count == 1
+	}
+	for _, tt := range []struct {
+		name   string
+		sent   bool
+		userID uint
+		want   bool
+	}{
+		{"sender before sending", false, alice.ID, true},
+		{"receiver before sending", false, bob.ID, false},
+		{"receiver once sent", true, bob.ID, true},
+		{"outsider once sent", true, carol.ID, false},
+	} {
+		msg.Sent = tt.sent
+		database.Model(&msg).Update("sent", tt.sent)
+		if canAccess, inScope := visible(tt.userID); canAccess != tt.want || inScope != tt.want {
+			t.Errorf("%s: CanAccess %v, VisibleTo %v; want %v", tt.name, canAccess, inScope, tt.want)
+		}
+	}
+}
+
+func TestNotBlockedBy(t *testing.T) {
+	database := newTestDB(t)
+	ms := NewMessageService(database)
+	alice := createTestUser(t, database, "alice", entity.UserRoleUser)
+	bob := createTestUser(t, database, "bob", entity.UserRoleUser)
+	carol := createTestUser(t, database, "carol", entity.UserRoleUser)
+	database.Create(&entity.BlockedUser{UserID: alice.ID, BlockedID: bob.ID})
+
+	for _, sender := range []entity.User{alice, bob, carol} {
+		database.Create(&entity.Message{SenderID: sender.ID, GroupID: 1, Content: sender.Username})
+	}
+	var senders []uint
+	database.Model(&entity.Message{}).Scopes(ms.NotBlockedBy(alice.ID)).Order("id").Pluck("sender_id", &senders)
+	if len(senders) != 2 || senders[0] != alice.ID || senders[1] != carol.ID {
+		t.Fatalf("got senders %v, want %d and %d", senders, alice.ID, carol.ID)
+	}
+}
+
+func TestSentWhileMemberAndNotExpired(t *testing.T) {
+	database := newTestDB(t)
+	ms := NewMessageService(database)
+	alice := createTestUser(t, database, "alice", entity.UserRoleUser)
+	bob := createTestUser(t, database, "bob", entity.UserRoleUser)
+	group := entity.Group{Name: "team"}
+	database.Create(&group)
+
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	database.Create(&entity.GroupMember{GroupID: group.ID, UserID: alice.ID, Model: gorm.Model{CreatedAt: now.Add(-2 * time.Hour)}})
+	database.Create(&entity.GroupMember{GroupID: group.ID, UserID: bob.ID, Model: gorm.Model{CreatedAt: now.Add(-time.Hour)}})
+	messages := map[string]*entity.Message{
+		"before bob joined": {Model: gorm.Model{CreatedAt: now.Add(-90 * time.Minute)}},
+		"after bob joined":  {Model: gorm.Model{CreatedAt: now.Add(-30 * time.Minute)}},
+		"expired":           {Model: gorm.Model{CreatedAt: now.Add(-30 * time.Minute)}, ExpiresAt: &past},
+		"expiring later":    {Model: gorm.Model{CreatedAt: now.Add(-30 * time.Minute)}, ExpiresAt: &future},
+	}
+	for content, msg := range messages {
+		msg.SenderID, msg.GroupID, msg.Content = alice.ID, group.ID, content
+		if err := database.Create(msg).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	visible := func(userID uint, scopes ...func(*gorm.DB) *gorm.DB) []string {
+		var contents []string
+		database.Model(&entity.Message{}).Scopes(scopes...).Order("content").Pluck("content", &contents)
+		return contents
+	}
+	if got := visible(bob.ID, ms.SentWhileMember(bob.ID), ms.NotExpired()); !slices.Equal(got, []string{"after bob joined", "expiring later"}) {
+		t.Errorf("bob sees %q", got)
+	}
+	if got := visible(alice.ID, ms.VisibleTo(alice.ID)); slices.Contains(got, "expired") || len(got) != 3 {
+		t.Errorf("VisibleTo shows alice %q", got)
+	}
+	if ms.CanAccess(alice.ID, messages["expired"]) {
+		t.Error("CanAccess allows an expired message")
+	}
+}
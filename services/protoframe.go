@@ -0,0 +1,216 @@
+package services
+
+import (
+	"chat_app/entity"
+	"chat_app/genproto/chatpb"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EncodeProtoFrame converts a JSON frame, as written to WebSocket clients,
+// into its protobuf form, so every transport shares one delivery pipeline.
+func EncodeProtoFrame(data []byte) (*chatpb.ServerFrame, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	frame := &chatpb.ServerFrame{}
+	if seq, ok := fields["session_seq"].(float64); ok {
+		frame.SessionSeq = uint64(seq)
+		delete(fields, "session_seq")
+	}
+
+	switch {
+	case fields["resume_token"] != nil:
+		var welcome struct {
+			UserID         uint64 `json:"user_id"`
+			ResumeToken    string `json:"resume_token"`
+			Resumed        bool   `json:"resumed"`
+			Replayed       uint32 `json:"replayed"`
+			LastSessionSeq uint64 `json:"last_session_seq"`
+		}
+		if err := json.Unmarshal(data, &welcome); err != nil {
+			return nil, err
+		}
+		frame.Frame = &chatpb.ServerFrame_Welcome{Welcome: &chatpb.Welcome{
+			UserId:         welcome.UserID,
+			ResumeToken:    welcome.ResumeToken,
+			Resumed:        welcome.Resumed,
+			Replayed:       welcome.Replayed,
+			LastSessionSeq: welcome.LastSessionSeq,
+		}}
+	case fields["error"] != nil:
+		text, _ := fields["error"].(string)
+		frame.Frame = &chatpb.ServerFrame_Error{Error: &chatpb.Error{Error: text}}
+	case fields["event"] == "ack":
+		var ack struct {
+			ID          uint64         `json:"id"`
+			ClientMsgID string         `json:"client_msg_id"`
+			Duplicate   bool           `json:"duplicate"`
+			Message     string         `json:"message"`
+			Stored      entity.Message `json:"stored"`
+		}
+		if err := json.Unmarshal(data, &ack); err != nil {
+			return nil, err
+		}
+		frame.Frame = &chatpb.ServerFrame_Ack{Ack: &chatpb.Ack{
+			Id:          ack.ID,
+			ClientMsgId: ack.ClientMsgID,
+			Duplicate:   ack.Duplicate,
+			Message:     ack.Message,
+			Stored:      MessageToProto(ack.Stored),
+		}}
+	case fields["event"] != nil:
+		event, _ := fields["event"].(string)
+		delete(fields, "event")
+		details, err := structpb.NewStruct(fields)
+		if err != nil {
+			return nil, err
+		}
+		frame.Frame = &chatpb.ServerFrame_Event{Event: &chatpb.Event{Event: event, Data: details}}
+	default:
+		var msg entity.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+		frame.Frame = &chatpb.ServerFrame_Message{Message: MessageToProto(msg)}
+	}
+	return frame, nil
+}
+
+// MessageFromProto converts a message sent by a client. Fields the server
+// assigns are left for handleClient to fill in.
+func MessageFromProto(send *chatpb.SendMessage) entity.Message {
+	msg := entity.Message{
+		ReceiverID:  uint(send.GetReceiverId()),
+		GroupID:     uint(send.GetGroupId()),
+		Content:     send.GetContent(),
+		Format:      send.GetFormat(),
+		Blocks:      BlocksFromProto(send.GetBlocks()),
+		ClientMsgID: send.GetClientMsgId(),
+	}
+	for _, id := range send.GetAttachmentIds() {
+		msg.AttachmentIDs = append(msg.AttachmentIDs, uint(id))
+	}
+	if send.ScheduledTime != nil {
+		scheduled := send.ScheduledTime.AsTime()
+		msg.ScheduledTime = &scheduled
+	}
+	return msg
+}
+
+func MessageToProto(msg entity.Message) *chatpb.Message {
+	pb := &chatpb.Message{
+		Id:                     uint64(msg.ID),
+		CreatedAt:              timestamppb.New(msg.CreatedAt),
+		SenderId:               uint64(msg.SenderID),
+		ReceiverId:             uint64(msg.ReceiverID),
+		GroupId:                uint64(msg.GroupID),
+		ConversationId:         uint64(msg.ConversationID),
+		Seq:                    msg.Seq,
+		Content:                msg.Content,
+		Format:                 msg.Format,
+		ClientMsgId:            msg.ClientMsgID,
+		Kind:                   msg.Kind,
+		SystemEvent:            msg.SystemEvent,
+		ActorId:                uint64(msg.ActorID),
+		TargetUserId:           uint64(msg.TargetUserID),
+		ScheduledTime:          Timestamp(msg.ScheduledTime),
+		Sent:                   msg.Sent,
+		ExpiresAt:              Timestamp(msg.ExpiresAt),
+		ForwardedFromSenderId:  uint64(msg.ForwardedFromSenderID),
+		ForwardedFromGroupId:   uint64(msg.ForwardedFromGroupID),
+		ForwardedFromMessageId: uint64(msg.ForwardedFromMessageID),
+		Blocks:                 BlocksToProto(msg.Blocks),
+	}
+	for _, attachment := range msg.Attachments {
+		pb.Attachments = append(pb.Attachments, &chatpb.Attachment{
+			Id:           uint64(attachment.ID),
+			UploaderId:   uint64(attachment.UploaderID),
+			MessageId:    uint64(attachment.MessageID),
+			FileName:     attachment.FileName,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+			Width:        int32(attachment.Width),
+			Height:       int32(attachment.Height),
+			Blurhash:     attachment.Blurhash,
+			ThumbnailUrl: attachment.ThumbnailURL,
+			PreviewUrl:   attachment.PreviewURL,
+		})
+	}
+	for _, id := range msg.Mentions {
+		pb.Mentions = append(pb.Mentions, uint64(id))
+	}
+	return pb
+}
+
+func BlocksFromProto(pbs []*chatpb.Block) entity.Blocks {
+	var blocks entity.Blocks
+	for _, pb := range pbs {
+		block := entity.Block{
+			Type:        pb.GetType(),
+			BlockID:     pb.GetBlockId(),
+			Text:        pb.GetText(),
+			SubmitLabel: pb.GetSubmitLabel(),
+		}
+		for _, e := range pb.GetElements() {
+			element := entity.Element{
+				Type:        e.GetType(),
+				ActionID:    e.GetActionId(),
+				Label:       e.GetLabel(),
+				Value:       e.GetValue(),
+				Style:       e.GetStyle(),
+				Placeholder: e.GetPlaceholder(),
+				Required:    e.GetRequired(),
+				Multiline:   e.GetMultiline(),
+			}
+			for _, o := range e.GetOptions() {
+				element.Options = append(element.Options, entity.Option{Label: o.GetLabel(), Value: o.GetValue()})
+			}
+			block.Elements = append(block.Elements, element)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func BlocksToProto(blocks entity.Blocks) []*chatpb.Block {
+	var pbs []*chatpb.Block
+	for _, block := range blocks {
+		pb := &chatpb.Block{
+			Type:        block.Type,
+			BlockId:     block.BlockID,
+			Text:        block.Text,
+			SubmitLabel: block.SubmitLabel,
+		}
+		for _, e := range block.Elements {
+			element := &chatpb.Element{
+				Type:        e.Type,
+				ActionId:    e.ActionID,
+				Label:       e.Label,
+				Value:       e.Value,
+				Style:       e.Style,
+				Placeholder: e.Placeholder,
+				Required:    e.Required,
+				Multiline:   e.Multiline,
+			}
+			for _, o := range e.Options {
+				element.Options = append(element.Options, &chatpb.Option{Label: o.Label, Value: o.Value})
+			}
+			pb.Elements = append(pb.Elements, element)
+		}
+		pbs = append(pbs, pb)
+	}
+	return pbs
+}
+
+// Timestamp converts an optional time, leaving the field unset for nil.
+func Timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"chat_app/entity"
+	"log"
+	"time"
+)
+
+// reactionCountInterval is how often the reaction counts of a channel
+// message are sent at most.
+const reactionCountInterval = 2 * time.Second
+
+// ReactionCount is the number of reactions to a message with one emoji.
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+}
+
+// ReactionCounts returns the reaction counts of a message, most used first.
+func (ms *MessageService) ReactionCounts(messageID uint) ([]ReactionCount, error) {
+	counts := []ReactionCount{}
+	err := ms.DB.Model(&entity.MessageReaction{}).
+		Select("emoji, COUNT(*) AS count").
+		Where("message_id = ?", messageID).
+		Group("emoji").
+		Order("count DESC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// NotifyReaction tells the audience of a message that a reaction was added
+// or removed. In announcement channels every subscriber would get an event
+// per reaction, so they get a reaction_counts event with the totals
+// instead, at most once per reactionCountInterval and message.
+func (ws *WebSocketService) NotifyReaction(msg *entity.Message, event string, reaction entity.MessageReaction) {
+	if msg.GroupID != 0 {
+		var group entity.Group
+		if err := ws.DB.Select("type").First(&group, msg.GroupID).Error; err == nil && group.Type == entity.GroupTypeChannel {
+			ws.queueReactionCounts(*msg)
+			return
+		}
+	}
+
+	audience, err := ws.Messages.Audience(msg)
+	if err != nil {
+		log.Printf("Error fetching the audience of message %d: %v", msg.ID, err)
+		return
+	}
+	ws.SendToUsers(audience, map[string]interface{}{
+		"event":      event,
+		"message_id": msg.ID,
+		"group_id":   msg.GroupID,
+		"user_id":    reaction.UserID,
+		"emoji":      reaction.Emoji,
+	})
+}
+
+// queueReactionCounts sends the reaction counts of a message once the
+// interval is over, unless a send is already queued.
+func (ws *WebSocketService) queueReactionCounts(msg entity.Message) {
+	ws.reactionMu.Lock()
+	defer ws.reactionMu.Unlock()
+	if ws.pendingReactionCounts[msg.ID] {
+		return
+	}
+	ws.pendingReactionCounts[msg.ID] = true
+
+	time.AfterFunc(reactionCountInterval, func() {
+		ws.reactionMu.Lock()
+		delete(ws.pendingReactionCounts, msg.ID)
+		ws.reactionMu.Unlock()
+
+		counts, err := ws.Messages.ReactionCounts(msg.ID)
+		if err != nil {
+			log.Printf("Error counting reactions to message %d: %v", msg.ID, err)
+			return
+		}
+		audience, err := ws.Messages.Audience(&msg)
+		if err != nil {
+			log.Printf("Error fetching the audience of message %d: %v", msg.ID, err)
+			return
+		}
+		ws.SendToUsers(audience, map[string]interface{}{
+			"event":      "reaction_counts",
+			"message_id": msg.ID,
+			"group_id":   msg.GroupID,
+			"counts":     counts,
+		})
+	})
+}
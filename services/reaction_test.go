@@ -0,0 +1,67 @@
+package services
+
+import (
+	"chat_app/entity"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNotifyReaction(t *testing.T) {
+	ws := newTestService(t)
+	owner := createTestUser(t, ws.DB, "owner", entity.UserRoleUser)
+	subscriber := createTestUser(t, ws.DB, "subscriber", entity.UserRoleUser)
+
+	// Frames the subscriber's detached session buffers
+	session, err := newSession(subscriber.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.detachedAt = time.Now()
+	ws.Mutex.Lock()
+	ws.Sessions[session.Token] = session
+	ws.Mutex.Unlock()
+	events := func() []string {
+		ws.Mutex.Lock()
+		defer ws.Mutex.Unlock()
+		var names []string
+		for _, frame := range session.frames {
+			var event struct {
+				Event string `json:"event"`
+			}
+			json.Unmarshal(frame.data, &event)
+			names = append(names, event.Event)
+		}
+		session.frames = nil
+		return names
+	}
+
+	react := func(groupType string) {
+		group := entity.Group{Name: groupType, Type: groupType}
+		ws.DB.Create(&group)
+		for _, user := range []entity.User{owner, subscriber} {
+			ws.DB.Create(&entity.GroupMember{GroupID: group.ID, UserID: user.ID})
+		}
+		msg := entity.Message{SenderID: owner.ID, GroupID: group.ID, Content: "news"}
+		ws.DB.Create(&msg)
+		for _, emoji := range []string{"👍", "🎉", "🔥"} {
+			reaction := entity.MessageReaction{MessageID: msg.ID, UserID: owner.ID, Emoji: emoji}
+			ws.DB.Create(&reaction)
+			ws.NotifyReaction(&msg, "reaction_added", reaction)
+		}
+	}
+
+	react(entity.GroupTypeGroup)
+	if got := events(); len(got) != 3 || got[0] != "reaction_added" {
+		t.Fatalf("group: got events %v, want 3 reaction_added", got)
+	}
+
+	react(entity.GroupTypeChannel)
+	if got := events(); len(got) != 0 {
+		t.Fatalf("channel: got events %v before the interval", got)
+	}
+	time.Sleep(reactionCountInterval + 500*time.Millisecond)
+	if got := events(); len(got) != 1 || got[0] != "reaction_counts" {
+		t.Fatalf("channel: got events %v, want one reaction_counts", got)
+	}
+}
@@ -11,14 +11,16 @@ import (
 type SchedulerService struct {
 	DB               *gorm.DB
 	WebSocketService *WebSocketService
+	Webhooks         *WebhookService
 	Ticker           *time.Ticker
 	Done             chan bool
 }
 
-func NewSchedulerService(db *gorm.DB, wsService *WebSocketService) *SchedulerService {
+func NewSchedulerService(db *gorm.DB, wsService *WebSocketService, webhookService *WebhookService) *SchedulerService {
 	ss := &SchedulerService{
 		DB:               db,
 		WebSocketService: wsService,
+		Webhooks:         webhookService,
 		Ticker:           time.NewTicker(10 * time.Second), // Check every 10 seconds
 		Done:             make(chan bool),
 	}
@@ -35,6 +37,8 @@ func (ss *SchedulerService) run() {
 		case t := <-ss.Ticker.C:
 			log.Printf("Checking for scheduled messages at %v", t)
 			ss.processScheduledMessages()
+			ss.deleteExpiredMessages()
+			ss.Webhooks.RetryDue()
 		}
 	}
 }
@@ -47,8 +51,8 @@ func (ss *SchedulerService) processScheduledMessages() {
 
 	log.Printf("Current time (UTC): %v, Window: [%v, %v]", now, windowStart, windowEnd)
 
-	// Find messages within the window that haven't been sent
-	if err := ss.DB.Where("scheduled_time >= ? AND scheduled_time <= ? AND sent = ?", windowStart, windowEnd, false).Find(&messages).Error; err != nil {
+	// Find messages within the window that haven't been sent or rejected
+	if err := ss.DB.Where("scheduled_time >= ? AND scheduled_time <= ? AND sent = ? AND send_error = ''", windowStart, windowEnd, false).Find(&messages).Error; err != nil {
 		log.Printf("Error fetching scheduled messages: %v", err)
 		return
 	}
@@ -56,14 +60,9 @@ func (ss *SchedulerService) processScheduledMessages() {
 	for _, msg := range messages {
 		log.Printf("Processing scheduled message ID %d, scheduled for %v", msg.ID, msg.ScheduledTime)
 
-		// Send the message via the WebSocketService's Broadcast channel
+		// Send the message via the WebSocketService's Broadcast channel.
+		// handleMessages marks it as sent, or as failed if it is rejected.
 		ss.WebSocketService.Broadcast <- msg
-
-		// Mark the message as sent
-		msg.Sent = true
-		if err := ss.DB.Save(&msg).Error; err != nil {
-			log.Printf("Error marking message ID %d as sent: %v", msg.ID, err)
-		}
 	}
 }
 
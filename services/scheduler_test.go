@@ -0,0 +1,81 @@
+package services
+
+import (
+	"chat_app/entity"
+	"testing"
+	"time"
+)
+
+func TestScheduledMessageSentOrFailed(t *testing.T) {
+	ws := newTestService(t)
+	ss := &SchedulerService{DB: ws.DB, WebSocketService: ws, Webhooks: ws.Webhooks}
+	alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+	later := time.Now().Add(time.Hour)
+	open := entity.Group{Name: "open"}
+	muted := entity.Group{Name: "muted"}
+	ws.DB.Create(&open)
+	ws.DB.Create(&muted)
+	ws.DB.Create(&entity.GroupMember{GroupID: open.ID, UserID: alice.ID})
+	ws.DB.Create(&entity.GroupMember{GroupID: muted.ID, UserID: alice.ID, MutedUntil: &later})
+
+	due := time.Now().UTC().Add(5 * time.Second)
+	ok := entity.Message{SenderID: alice.ID, GroupID: open.ID, Content: "ok", ScheduledTime: &due}
+	rejected := entity.Message{SenderID: alice.ID, GroupID: muted.ID, Content: "muted", ScheduledTime: &due}
+	ws.DB.Create(&ok)
+	ws.DB.Create(&rejected)
+
+	// Picking the messages up twice sends them once
+	ss.processScheduledMessages()
+	ss.processScheduledMessages()
+	reload := func(msg entity.Message) entity.Message {
+		var stored entity.Message
+		ws.DB.First(&stored, msg.ID)
+		return stored
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for reload(rejected).SendError == "" || reload(ok).Seq == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("messages were not processed: %+v, %+v", reload(ok), reload(rejected))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	drain(t, ws, alice.ID, open.ID, "flush")
+	if got := reload(ok); !got.Sent || got.SendError != "" || got.Seq != 1 {
+		t.Fatalf("sent message: %+v", got)
+	}
+	if got := reload(rejected); got.Sent || got.SendError == "" {
+		t.Fatalf("rejected message: %+v", got)
+	}
+	var conversation entity.Conversation
+	ws.DB.Where("group_id = ?", open.ID).First(&conversation)
+	if conversation.LastSeq != 2 {
+		t.Fatalf("got last seq %d, want the scheduled message and the flush only", conversation.LastSeq)
+	}
+
+	// A rejected message is not retried, even once it could be sent
+	ws.DB.Model(&entity.GroupMember{}).Where("group_id = ?", muted.ID).Update("muted_until", nil)
+	ss.processScheduledMessages()
+	drain(t, ws, alice.ID, open.ID, "flush again")
+	if got := reload(rejected); got.Sent {
+		t.Fatal("a rejected message was sent on the next tick")
+	}
+}
+
+// drain waits until handleMessages has stored a message queued after
+// everything before it.
+func drain(t *testing.T, ws *WebSocketService, senderID, groupID uint, content string) {
+	t.Helper()
+	ws.Broadcast <- entity.Message{SenderID: senderID, GroupID: groupID, Content: content, Kind: entity.MessageKindText}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var count int64
+		ws.DB.Model(&entity.Message{}).Where("content = ?", content).Count(&count)
+		if count == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the pipeline did not drain")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
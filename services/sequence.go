@@ -0,0 +1,83 @@
+package services
+
+import (
+	"chat_app/entity"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// nextSeq files a message under its conversation, creating the conversation
+// with the first message, and reserves the conversation's next sequence
+// number. It must run in the transaction that stores the message: the
+// conversation row stays locked until commit, and a failed insert rolls the
+// number back, so sequences are gapless and ordered even with several
+// servers writing. Server-wide broadcasts belong to no conversation.
+func nextSeq(tx *gorm.DB, msg *entity.Message) error {
+	var key entity.Conversation
+	switch {
+	case msg.GroupID != 0:
+		key = entity.Conversation{Type: entity.ConversationTypeGroup, GroupID: msg.GroupID}
+	case msg.ReceiverID != 0:
+		key = entity.DirectConversation(msg.SenderID, msg.ReceiverID)
+	default:
+		return nil
+	}
+
+	var conversation entity.Conversation
+	if err := tx.Raw(`INSERT INTO conversations (type, group_id, low_user_id, high_user_id, message_ttl, last_seq, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 0, 1, NOW(), NOW())
+		ON CONFLICT (group_id, low_user_id, high_user_id) DO UPDATE SET last_seq = conversations.last_seq + 1, updated_at = NOW()
+		RETURNING *`, key.Type, key.GroupID, key.LowUserID, key.HighUserID).Scan(&conversation).Error; err != nil {
+		return err
+	}
+	if conversation.LastSeq == 1 {
+		if err := addParticipants(tx, &conversation); err != nil {
+			return err
+		}
+	}
+	msg.ConversationID = conversation.ID
+	msg.Seq = conversation.LastSeq
+	return nil
+}
+
+// addParticipants records both users of a new direct conversation.
+func addParticipants(tx *gorm.DB, conversation *entity.Conversation) error {
+	if conversation.Type != entity.ConversationTypeDirect {
+		return nil
+	}
+	participants := []entity.ConversationParticipant{
+		{ConversationID: conversation.ID, UserID: conversation.LowUserID},
+		{ConversationID: conversation.ID, UserID: conversation.HighUserID},
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&participants).Error
+}
+
+// storeMessage inserts a new message with the next sequence number of its
+// conversation and links its attachments. Nothing is stored if one of them
+// was sent with another message in the meantime.
+func (ws *WebSocketService) storeMessage(msg *entity.Message) error {
+	return ws.DB.Transaction(func(tx *gorm.DB) error {
+		if err := nextSeq(tx, msg); err != nil {
+			return err
+		}
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return ws.Attachments.Link(tx, msg.ID, msg.SenderID, msg.AttachmentIDs)
+	})
+}
+
+// assignSeq numbers a message that was stored before delivery, such as a
+// scheduled message, so it takes its place in the conversation when sent.
+func (ws *WebSocketService) assignSeq(msg *entity.Message) error {
+	return ws.DB.Transaction(func(tx *gorm.DB) error {
+		if err := nextSeq(tx, msg); err != nil {
+			return err
+		}
+		return tx.Model(msg).Updates(map[string]interface{}{
+			"conversation_id": msg.ConversationID,
+			"seq":             msg.Seq,
+		}).Error
+	})
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ResumeGracePeriod is how long a dropped session keeps collecting
+	// frames for a client to resume it.
+	ResumeGracePeriod = 2 * time.Minute
+	// resumeBufferBytes caps the payload bytes of the frames kept per
+	// session. A client that missed more than this gets a fresh session and
+	// must sync.
+	resumeBufferBytes = 1 << 20
+	// maxDetachedSessions caps the detached sessions kept per user. Every
+	// poll or SSE request without a valid resume token opens a session, so
+	// without a cap a client could pin buffers for the whole grace period.
+	maxDetachedSessions = 5
+	// clientQueueSize bounds the live frames waiting to be written to a
+	// connection; replayed frames are written from the session buffer. A
+	// client that falls further behind is detached and has to resume.
+	clientQueueSize = 256
+)
+
+// Session outlives a single WebSocket connection. Every frame sent to the
+// session is numbered with session_seq and kept in a bounded buffer, so a
+// client that reconnects with the resume token and the last session_seq it
+// received gets the frames it missed replayed in order.
+type Session struct {
+	Token      string
+	UserID     uint
+	client     *Client // nil while detached
+	lastSeq    uint64
+	frames     []sessionFrame
+	frameBytes int // Payload bytes in frames
+	detachedAt time.Time
+}
+
+// sessionFrame is a frame and its session_seq, which is only added when the
+// frame is written, so the payload of a fan-out is shared by all sessions.
+// Frames outside a session, such as the greeting, have seq 0.
+type sessionFrame struct {
+	seq  uint64
+	data []byte
+}
+
+// encode returns the frame as written to the connection.
+func (f sessionFrame) encode() []byte {
+	if f.seq == 0 {
+		return f.data
+	}
+	return withSessionSeq(f.data, f.seq)
+}
+
+func newSession(userID uint) (*Session, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Session{Token: hex.EncodeToString(b), UserID: userID}, nil
+}
+
+// sendFrame numbers a JSON object frame, buffers it and queues it for the
+// attached connection, if any. data must not be modified afterwards. The
+// caller must hold ws.Mutex.
+func (ws *WebSocketService) sendFrame(session *Session, data []byte) {
+	session.lastSeq++
+	frame := sessionFrame{seq: session.lastSeq, data: data}
+	session.frames = append(session.frames, frame)
+	session.frameBytes += len(data)
+	dropped := 0
+	for session.frameBytes > resumeBufferBytes && dropped < len(session.frames)-1 {
+		session.frameBytes -= len(session.frames[dropped].data)
+		dropped++
+	}
+	session.frames = session.frames[dropped:]
+	if session.client != nil {
+		ws.queueFrame(session.client, frame)
+	}
+}
+
+// queueFrame hands a frame to the writer of a connection without blocking.
+// A connection whose queue is full is dropped; its session keeps buffering,
+// so the client catches up by resuming. The caller must hold ws.Mutex.
+func (ws *WebSocketService) queueFrame(client *Client, frame sessionFrame) {
+	if client.detached {
+		return
+	}
+	select {
+	case client.send <- frame:
+	default:
+		log.Printf("Send queue of user %d is full, dropping the connection", client.UserID)
+		ws.detach(client)
+		go client.Conn.Close()
+	}
+}
+
+// detach stops queueing frames for a connection and, unless a newer
+// connection took its session over, keeps the session for a resume. The
+// caller must hold ws.Mutex.
+func (ws *WebSocketService) detach(client *Client) {
+	if client.detached {
+		return
+	}
+	client.detached = true
+	close(client.send)
+	if client.Session != nil && client.Session.client == client {
+		client.Session.client = nil
+		client.Session.detachedAt = time.Now()
+	}
+}
+
+// writeFrames writes the first frames, the greeting and any replay, then
+// the queued frames of a connection in order until the queue is closed, and
+// closes the connection. After a failed write the rest is discarded; the
+// session still has the frames.
+func (ws *WebSocketService) writeFrames(client *Client, first []sessionFrame) {
+	defer close(client.written)
+	failed := false
+	write := func(frame sessionFrame) {
+		if failed {
+			return
+		}
+		if err := client.Conn.WriteMessage(websocket.TextMessage, frame.encode()); err != nil {
+			log.Printf("Error sending frame to user %d: %v", client.UserID, err)
+			failed = true
+			client.Conn.Close()
+		}
+	}
+	for _, frame := range first {
+		write(frame)
+	}
+	for frame := range client.send {
+		write(frame)
+	}
+	client.Conn.Close()
+}
+
+// withSessionSeq adds a session_seq field to an encoded JSON object.
+func withSessionSeq(data []byte, seq uint64) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	framed := []byte(fmt.Sprintf(`{"session_seq":%d`, seq))
+	if data[1] != '}' {
+		framed = append(framed, ',')
+	}
+	return append(framed, data[1:]...)
+}
+
+// reply sends a payload to the session of one connection.
+func (ws *WebSocketService) reply(client *Client, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding reply to user %d: %v", client.UserID, err)
+		return
+	}
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	ws.sendFrame(client.Session, data)
+}
+
+// resumeSession returns the session named by a resume token together with
+// the frames to replay, or nil if it cannot be resumed without losing
+// frames: unknown or expired token, another user's session, or a last
+// session_seq that is no longer buffered. The caller must hold ws.Mutex.
+func (ws *WebSocketService) resumeSession(userID uint, token, lastSeqParam string) (*Session, []sessionFrame) {
+	session, ok := ws.Sessions[token]
+	if !ok || session.UserID != userID {
+		return nil, nil
+	}
+	lastSeq, err := strconv.ParseUint(lastSeqParam, 10, 64)
+	if err != nil || lastSeq > session.lastSeq {
+		return nil, nil
+	}
+	if session.client == nil && time.Since(session.detachedAt) > ResumeGracePeriod {
+		delete(ws.Sessions, token)
+		return nil, nil
+	}
+	if lastSeq == session.lastSeq {
+		return session, nil
+	}
+	if len(session.frames) == 0 || session.frames[0].seq > lastSeq+1 {
+		return nil, nil
+	}
+	return session, session.frames[lastSeq+1-session.frames[0].seq:]
+}
+
+// evictDetachedSessions drops the oldest detached sessions of a user until
+// there is room for one more. The caller must hold ws.Mutex.
+func (ws *WebSocketService) evictDetachedSessions(userID uint) {
+	var detached []*Session
+	for _, session := range ws.Sessions {
+		if session.UserID == userID && session.client == nil {
+			detached = append(detached, session)
+		}
+	}
+	if len(detached) < maxDetachedSessions {
+		return
+	}
+	slices.SortFunc(detached, func(a, b *Session) int { return a.detachedAt.Compare(b.detachedAt) })
+	for _, session := range detached[:len(detached)-maxDetachedSessions+1] {
+		delete(ws.Sessions, session.Token)
+	}
+	log.Printf("Evicted %d detached sessions of user %d", len(detached)-maxDetachedSessions+1, userID)
+}
+
+// expireSessions drops detached sessions once their grace period is over.
+func (ws *WebSocketService) expireSessions() {
+	ticker := time.NewTicker(ResumeGracePeriod / 4)
+	defer ticker.Stop()
+	for range ticker.C {
+		ws.Mutex.Lock()
+		for token, session := range ws.Sessions {
+			if session.client == nil && time.Since(session.detachedAt) > ResumeGracePeriod {
+				delete(ws.Sessions, token)
+			}
+		}
+		ws.Mutex.Unlock()
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetachedSessionsAreCapped(t *testing.T) {
+	ws := newTestService(t)
+	poll := func(query string) string {
+		rec := httptest.NewRecorder()
+		ws.Poll(rec, httptest.NewRequest("GET", "/poll?timeout=0"+query, nil), 1)
+		var resp struct {
+			Frames []struct {
+				ResumeToken string `json:"resume_token"`
+			} `json:"frames"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Frames) == 0 {
+			t.Fatalf("poll failed: %d %v", rec.Code, err)
+		}
+		return resp.Frames[0].ResumeToken
+	}
+
+	var tokens []string
+	for range maxDetachedSessions + 3 {
+		tokens = append(tokens, poll(""))
+	}
+	ws.Mutex.Lock()
+	count := len(ws.Sessions)
+	_, oldestKept := ws.Sessions[tokens[0]]
+	_, newestKept := ws.Sessions[tokens[len(tokens)-1]]
+	ws.Mutex.Unlock()
+	if count != maxDetachedSessions {
+		t.Fatalf("got %d sessions, want %d", count, maxDetachedSessions)
+	}
+	if oldestKept || !newestKept {
+		t.Fatalf("kept the oldest session: %v, kept the newest: %v", oldestKept, newestKept)
+	}
+
+	// Resuming reuses the session instead of opening another one
+	if token := poll("&resume_token=" + tokens[len(tokens)-1] + "&last_seq=0"); token != tokens[len(tokens)-1] {
+		t.Fatalf("resume returned a new session")
+	}
+}
+
+// stalledConn never completes a write, like a client that stopped reading.
+type stalledConn struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *stalledConn) ReadJSON(v interface{}) error {
+	<-c.closed
+	return errTransportClosed
+}
+
+func (c *stalledConn) WriteJSON(v interface{}) error { return c.WriteMessage(0, nil) }
+
+func (c *stalledConn) WriteMessage(int, []byte) error {
+	<-c.closed
+	return errTransportClosed
+}
+
+func (c *stalledConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func TestSlowClientIsDetached(t *testing.T) {
+	ws := newTestService(t)
+	conn := &stalledConn{closed: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		ws.Serve(conn, 1, "", "")
+		close(served)
+	}()
+	for attached := false; !attached; {
+		ws.Mutex.Lock()
+		attached = len(ws.Clients) == 1
+		ws.Mutex.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	// Fan-out does not wait for the stalled writer; the overflowing frame
+	// drops the connection
+	sent := clientQueueSize + 10
+	start := time.Now()
+	for i := range sent {
+		ws.SendToUsers([]uint{1}, map[string]int{"n": i})
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("fan-out took %v", elapsed)
+	}
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stalled connection was not dropped")
+	}
+
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	if len(ws.Sessions) != 1 {
+		t.Fatalf("got %d sessions, want the detached one", len(ws.Sessions))
+	}
+	for _, session := range ws.Sessions {
+		if session.client != nil || session.lastSeq != uint64(sent) {
+			t.Fatalf("session attached: %v, last seq %d; want detached with %d frames", session.client != nil, session.lastSeq, sent)
+		}
+	}
+}
+
+func TestResumeBufferIsCappedByBytes(t *testing.T) {
+	ws := newTestService(t)
+	var sessions []*Session
+	ws.Mutex.Lock()
+	for range 2 {
+		session, err := newSession(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.detachedAt = time.Now()
+		ws.Sessions[session.Token] = session
+		sessions = append(sessions, session)
+	}
+	ws.Mutex.Unlock()
+
+	payload := strings.Repeat("x", 1000)
+	sent := resumeBufferBytes/1000 + 100
+	for range sent {
+		ws.SendToUsers([]uint{1}, map[string]string{"payload": payload})
+	}
+
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	first, second := sessions[0], sessions[1]
+	if first.frameBytes > resumeBufferBytes || len(first.frames) >= sent {
+		t.Fatalf("buffered %d frames of %d bytes, want at most %d bytes", len(first.frames), first.frameBytes, resumeBufferBytes)
+	}
+	if last := first.frames[len(first.frames)-1]; last.seq != uint64(sent) {
+		t.Fatalf("newest buffered frame has seq %d, want %d", last.seq, sent)
+	}
+	// The fan-out payload is stored once; only the seq differs per session
+	if &first.frames[0].data[0] != &second.frames[0].data[0] {
+		t.Fatal("sessions hold separate copies of a frame")
+	}
+	var frame struct {
+		SessionSeq uint64 `json:"session_seq"`
+		Payload    string `json:"payload"`
+	}
+	if err := json.Unmarshal(first.frames[0].encode(), &frame); err != nil || frame.SessionSeq != first.frames[0].seq || frame.Payload != payload {
+		t.Fatalf("encoded frame: %+v, %v", frame, err)
+	}
+}
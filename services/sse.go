@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment line, so
+// proxies do not time it out.
+const sseKeepAlive = 25 * time.Second
+
+// errTransportClosed ends the read loop of connections that receive no
+// frames from the client, once the server closes them.
+var errTransportClosed = errors.New("connection closed")
+
+// sseConn is a receive-only connection over Server-Sent Events. Each frame
+// is one event whose id is "<resume_token>:<session_seq>", so the
+// Last-Event-ID header of a reconnecting EventSource resumes the session.
+type sseConn struct {
+	w         http.ResponseWriter
+	flusher   http.Flusher
+	ctx       context.Context
+	mu        sync.Mutex
+	token     string
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// ReadJSON blocks until the stream ends; clients send through the REST API.
+func (c *sseConn) ReadJSON(v interface{}) error {
+	select {
+	case <-c.closed:
+		return errTransportClosed
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+func (c *sseConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *sseConn) WriteMessage(_ int, data []byte) error {
+	var frame struct {
+		SessionSeq  uint64 `json:"session_seq"`
+		ResumeToken string `json:"resume_token"`
+	}
+	json.Unmarshal(data, &frame)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if frame.ResumeToken != "" {
+		c.token = frame.ResumeToken
+	}
+	event := fmt.Sprintf("data: %s\n\n", data)
+	if frame.SessionSeq != 0 {
+		event = fmt.Sprintf("id: %s:%d\n", c.token, frame.SessionSeq) + event
+	}
+	return c.write(event)
+}
+
+// write sends raw stream text. The caller must hold c.mu.
+func (c *sseConn) write(text string) error {
+	select {
+	case <-c.closed:
+		return errTransportClosed
+	default:
+	}
+	if _, err := fmt.Fprint(c.w, text); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+func (c *sseConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// ServeEvents streams a user's frames as Server-Sent Events, for clients
+// behind proxies that break WebSocket upgrades. A session is resumed with
+// the resume_token and last_seq query parameters, or a Last-Event-ID header.
+func (ws *WebSocketService) ServeEvents(w http.ResponseWriter, r *http.Request, userID uint) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	resumeToken, lastSeq := query.Get("resume_token"), query.Get("last_seq")
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if token, seq, ok := strings.Cut(lastEventID, ":"); ok {
+			resumeToken, lastSeq = token, seq
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	conn := &sseConn{w: w, flusher: flusher, ctx: r.Context(), closed: make(chan struct{})}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sseKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				conn.mu.Lock()
+				err := conn.write(": keep-alive\n\n")
+				conn.mu.Unlock()
+				if err != nil {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Event stream opened for user %d", userID)
+	// Serve returns once the connection is detached, so nothing writes to
+	// the response after the handler returns
+	ws.Serve(conn, userID, resumeToken, lastSeq)
+	close(stop)
+}
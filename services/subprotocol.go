@@ -0,0 +1,108 @@
+package services
+
+import (
+	"chat_app/genproto/chatpb"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// WebSocket subprotocols. Both carry the chat.v1 ClientFrame and ServerFrame
+// envelopes, as protobuf JSON or binary protobuf. Connections that negotiate
+// neither keep the plain JSON frames.
+const (
+	SubprotocolJSON  = "chat.v1.json"
+	SubprotocolProto = "chat.v1.proto"
+)
+
+// envelopeConn wraps a WebSocket that negotiated a chat.v1 subprotocol. The
+// service still writes JSON frames; they are converted to envelopes here.
+type envelopeConn struct {
+	*websocket.Conn
+	binary bool // chat.v1.proto
+}
+
+func newEnvelopeConn(conn *websocket.Conn) Conn {
+	switch conn.Subprotocol() {
+	case SubprotocolProto:
+		return &envelopeConn{Conn: conn, binary: true}
+	case SubprotocolJSON:
+		return &envelopeConn{Conn: conn}
+	}
+	return conn
+}
+
+func (c *envelopeConn) ReadJSON(v interface{}) error {
+	for {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		frame := &chatpb.ClientFrame{}
+		if c.binary {
+			err = proto.Unmarshal(data, frame)
+		} else {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, frame)
+		}
+		if err != nil {
+			return err
+		}
+		if ok, err := DecodeClientFrame(frame, v); ok || err != nil {
+			return err
+		}
+	}
+}
+
+func (c *envelopeConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *envelopeConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return c.Conn.WriteMessage(messageType, data)
+	}
+	frame, err := EncodeProtoFrame(data)
+	if err != nil {
+		return err
+	}
+	if c.binary {
+		data, err = proto.Marshal(frame)
+		messageType = websocket.BinaryMessage
+	} else {
+		data, err = protojson.Marshal(frame)
+	}
+	if err != nil {
+		return err
+	}
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// DecodeClientFrame stores the message or interaction a client frame
+// carries into v as a JSON frame would. It reports false for frames without
+// either, such as those of a newer client, which callers skip.
+func DecodeClientFrame(frame *chatpb.ClientFrame, v interface{}) (bool, error) {
+	var decoded interface{}
+	if send := frame.GetSend(); send != nil {
+		decoded = MessageFromProto(send)
+	} else if interaction := frame.GetInteraction(); interaction != nil {
+		decoded = clientFrame{Interaction: &InteractionRequest{
+			MessageID: uint(interaction.GetMessageId()),
+			ActionID:  interaction.GetActionId(),
+			Value:     interaction.GetValue(),
+			Values:    interaction.GetValues(),
+		}}
+	} else {
+		return false, nil
+	}
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		return true, err
+	}
+	return true, json.Unmarshal(data, v)
+}
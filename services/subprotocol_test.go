@@ -0,0 +1,456 @@
+package services
+
+import (
+	"chat_app/entity"
+	"chat_app/genproto/chatpb"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var subprotocols = []string{SubprotocolJSON, SubprotocolProto}
+
+// testClient speaks one chat.v1 subprotocol to a test server.
+type testClient struct {
+	t      *testing.T
+	conn   *websocket.Conn
+	binary bool
+}
+
+func (c *testClient) send(frame *chatpb.ClientFrame) {
+	c.t.Helper()
+	var data []byte
+	var err error
+	messageType := websocket.TextMessage
+	if c.binary {
+		data, err = proto.Marshal(frame)
+		messageType = websocket.BinaryMessage
+	} else {
+		data, err = protojson.Marshal(frame)
+	}
+	if err != nil {
+		c.t.Fatalf("encoding client frame: %v", err)
+	}
+	if err := c.conn.WriteMessage(messageType, data); err != nil {
+		c.t.Fatalf("writing client frame: %v", err)
+	}
+}
+
+func (c *testClient) read() *chatpb.ServerFrame {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("reading server frame: %v", err)
+	}
+	frame := &chatpb.ServerFrame{}
+	if c.binary {
+		if messageType != websocket.BinaryMessage {
+			c.t.Fatalf("got message type %d on %s, want binary", messageType, SubprotocolProto)
+		}
+		err = proto.Unmarshal(data, frame)
+	} else {
+		if messageType != websocket.TextMessage {
+			c.t.Fatalf("got message type %d on %s, want text", messageType, SubprotocolJSON)
+		}
+		err = protojson.Unmarshal(data, frame)
+	}
+	if err != nil {
+		c.t.Fatalf("decoding server frame %q: %v", data, err)
+	}
+	return frame
+}
+
+// readUntil skips frames, such as the acks of other scenarios, until one
+// matches.
+func (c *testClient) readUntil(match func(*chatpb.ServerFrame) bool) *chatpb.ServerFrame {
+	c.t.Helper()
+	for i := 0; i < 10; i++ {
+		if frame := c.read(); match(frame) {
+			return frame
+		}
+	}
+	c.t.Fatal("no matching frame")
+	return nil
+}
+
+func isEvent(name string) func(*chatpb.ServerFrame) bool {
+	return func(frame *chatpb.ServerFrame) bool {
+		return frame.GetEvent().GetEvent() == name
+	}
+}
+
+// newTestServer serves WebSocket connections for the user_id query
+// parameter, as the handler does after authenticating.
+func newTestServer(t *testing.T, ws *WebSocketService) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		ws.HandleConnections(w, r, uint(userID))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dial connects a user with a subprotocol and reads the welcome frame.
+func dial(t *testing.T, server *httptest.Server, subprotocol string, userID uint, query url.Values) (*testClient, *chatpb.Welcome) {
+	t.Helper()
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("user_id", strconv.Itoa(int(userID)))
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if conn.Subprotocol() != subprotocol {
+		t.Fatalf("negotiated %q, want %q", conn.Subprotocol(), subprotocol)
+	}
+	client := &testClient{t: t, conn: conn, binary: subprotocol == SubprotocolProto}
+	welcome := client.read().GetWelcome()
+	if welcome == nil || welcome.UserId != uint64(userID) || welcome.ResumeToken == "" {
+		t.Fatalf("got welcome %v", welcome)
+	}
+	return client, welcome
+}
+
+func TestSubprotocolConformance(t *testing.T) {
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, ws *WebSocketService, server *httptest.Server, subprotocol string)
+	}{
+		{"send and ack", func(t *testing.T, ws *WebSocketService, server *httptest.Server, subprotocol string) {
+			alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+			bob := createTestUser(t, ws.DB, "bob", entity.UserRoleUser)
+			sender, _ := dial(t, server, subprotocol, alice.ID, nil)
+			receiver, _ := dial(t, server, subprotocol, bob.ID, nil)
+
+			sender.send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Send{Send: &chatpb.SendMessage{
+				ReceiverId:  uint64(bob.ID),
+				Content:     "hello *bob*",
+				Format:      entity.MessageFormatMarkdown,
+				ClientMsgId: "c1",
+			}}})
+
+			ack := sender.read().GetAck()
+			if ack == nil || ack.ClientMsgId != "c1" || ack.Id == 0 || ack.Duplicate {
+				t.Fatalf("got ack %v", ack)
+			}
+			if ack.Stored.GetContent() != "hello *bob*" || ack.Stored.GetSenderId() != uint64(alice.ID) {
+				t.Fatalf("got stored message %v", ack.Stored)
+			}
+			frame := receiver.read()
+			msg := frame.GetMessage()
+			if msg == nil || msg.Id != ack.Id || msg.Content != "hello *bob*" || msg.Format != entity.MessageFormatMarkdown || msg.Seq != 1 {
+				t.Fatalf("got message %v", msg)
+			}
+			if frame.SessionSeq != 1 {
+				t.Fatalf("got session_seq %d, want 1", frame.SessionSeq)
+			}
+
+			// A resend is acknowledged as a duplicate
+			sender.send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Send{Send: &chatpb.SendMessage{
+				ReceiverId: uint64(bob.ID), Content: "hello *bob*", ClientMsgId: "c1",
+			}}})
+			if dup := sender.read().GetAck(); dup == nil || dup.Id != ack.Id || !dup.Duplicate {
+				t.Fatalf("got ack %v for a resend", dup)
+			}
+		}},
+		{"error", func(t *testing.T, ws *WebSocketService, server *httptest.Server, subprotocol string) {
+			alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+			client, _ := dial(t, server, subprotocol, alice.ID, nil)
+
+			client.send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Send{Send: &chatpb.SendMessage{Content: "nowhere"}}})
+			if e := client.read().GetError(); e.GetError() != "A message needs a receiver_id or group_id" {
+				t.Fatalf("got error %v", e)
+			}
+			client.send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Send{Send: &chatpb.SendMessage{ReceiverId: 99, Content: "x", Format: "html"}}})
+			if e := client.read().GetError(); e.GetError() != "Format must be plain or markdown" {
+				t.Fatalf("got error %v", e)
+			}
+		}},
+		{"event", func(t *testing.T, ws *WebSocketService, server *httptest.Server, subprotocol string) {
+			alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+			client, _ := dial(t, server, subprotocol, alice.ID, nil)
+
+			ws.SendToUsers([]uint{alice.ID}, map[string]interface{}{
+				"event":      "reaction_added",
+				"message_id": 7,
+				"emoji":      "👍",
+			})
+			event := client.read().GetEvent()
+			if event.GetEvent() != "reaction_added" {
+				t.Fatalf("got event %v", event)
+			}
+			data := event.GetData().AsMap()
+			if data["message_id"] != float64(7) || data["emoji"] != "👍" {
+				t.Fatalf("got event data %v", data)
+			}
+		}},
+		{"resume and replay", func(t *testing.T, ws *WebSocketService, server *httptest.Server, subprotocol string) {
+			alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+			client, welcome := dial(t, server, subprotocol, alice.ID, nil)
+			ws.SendToUsers([]uint{alice.ID}, map[string]interface{}{"event": "first"})
+			first := client.read()
+			client.conn.Close()
+
+			// Wait until the server notices, then send while detached
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				ws.Mutex.Lock()
+				detached := ws.Sessions[welcome.ResumeToken].client == nil
+				ws.Mutex.Unlock()
+				if detached {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("session was not detached")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			ws.SendToUsers([]uint{alice.ID}, map[string]interface{}{"event": "missed"})
+
+			resumed, again := dial(t, server, subprotocol, alice.ID, url.Values{
+				"resume_token": {welcome.ResumeToken},
+				"last_seq":     {strconv.FormatUint(first.SessionSeq, 10)},
+			})
+			if !again.Resumed || again.Replayed != 1 || again.ResumeToken != welcome.ResumeToken || again.LastSessionSeq != first.SessionSeq+1 {
+				t.Fatalf("got welcome %v", again)
+			}
+			replayed := resumed.read()
+			if replayed.GetEvent().GetEvent() != "missed" || replayed.SessionSeq != first.SessionSeq+1 {
+				t.Fatalf("got replayed frame %v", replayed)
+			}
+
+			// An unknown token starts a fresh session
+			_, fresh := dial(t, server, subprotocol, alice.ID, url.Values{"resume_token": {"unknown"}, "last_seq": {"0"}})
+			if fresh.Resumed || fresh.ResumeToken == welcome.ResumeToken {
+				t.Fatalf("got welcome %v for an unknown token", fresh)
+			}
+		}},
+		{"interaction", func(t *testing.T, ws *WebSocketService, server *httptest.Server, subprotocol string) {
+			alice := createTestUser(t, ws.DB, "alice", entity.UserRoleUser)
+			bot := createTestUser(t, ws.DB, "deploybot", entity.UserRoleBot)
+			if err := ws.DB.Create(&entity.Bot{UserID: bot.ID, OwnerID: alice.ID}).Error; err != nil {
+				t.Fatal(err)
+			}
+			botClient, _ := dial(t, server, subprotocol, bot.ID, nil)
+			client, _ := dial(t, server, subprotocol, alice.ID, nil)
+
+			blocks := entity.Blocks{
+				{Type: entity.BlockSection, Text: "Deploy to production?"},
+				{Type: entity.BlockActions, Elements: []entity.Element{
+					{Type: entity.ElementButton, ActionID: "approve", Label: "Approve", Value: "yes", Style: "primary"},
+					{Type: entity.ElementSelect, ActionID: "region", Options: []entity.Option{{Label: "EU", Value: "eu"}}},
+				}},
+			}
+			if _, err := ws.SubmitMessage(bot.ID, entity.Message{ReceiverID: alice.ID, Content: "Deploy?", Blocks: blocks}); err != nil {
+				t.Fatal(err)
+			}
+			msg := client.read().GetMessage()
+			if len(msg.GetBlocks()) != 2 || msg.Blocks[1].Elements[0].ActionId != "approve" || msg.Blocks[1].Elements[1].Options[0].Value != "eu" {
+				t.Fatalf("got message %v", msg)
+			}
+
+			client.send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Interaction{Interaction: &chatpb.Interaction{
+				MessageId: msg.Id,
+				ActionId:  "approve",
+				Value:     "forged", // Buttons submit their own value
+			}}})
+			sent := client.readUntil(isEvent("interaction_sent")).GetEvent().GetData().AsMap()
+			if sent["message_id"] != float64(msg.Id) || sent["action_id"] != "approve" {
+				t.Fatalf("got interaction_sent %v", sent)
+			}
+			received := botClient.readUntil(isEvent("interaction")).GetEvent().GetData().AsMap()
+			if received["value"] != "yes" || received["user_id"] != float64(alice.ID) || received["interaction_id"] != sent["interaction_id"] {
+				t.Fatalf("got interaction %v", received)
+			}
+
+			client.send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Interaction{Interaction: &chatpb.Interaction{
+				MessageId: msg.Id, ActionId: "region", Value: "mars",
+			}}})
+			if e := client.read().GetError(); e.GetError() != "Invalid option" {
+				t.Fatalf("got error %v", e)
+			}
+		}},
+	}
+
+	for _, subprotocol := range subprotocols {
+		for _, scenario := range scenarios {
+			t.Run(subprotocol+"/"+scenario.name, func(t *testing.T) {
+				ws := newTestService(t)
+				scenario.run(t, ws, newTestServer(t, ws), subprotocol)
+			})
+		}
+	}
+}
+
+// TestEncodeProtoFrame checks that every JSON frame the service writes has
+// an envelope that survives both wire encodings.
+func TestEncodeProtoFrame(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	stored := entity.Message{
+		SenderID:    1,
+		ReceiverID:  2,
+		Content:     "hi",
+		Format:      entity.MessageFormatPlain,
+		ClientMsgID: "c1",
+		Kind:        entity.MessageKindText,
+		Seq:         3,
+		Blocks:      entity.Blocks{{Type: entity.BlockSection, Text: "section"}},
+	}
+	stored.ID = 10
+	stored.CreatedAt = created
+
+	encode := func(v interface{}) []byte {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  *chatpb.ServerFrame
+	}{
+		{"welcome", encode(map[string]interface{}{
+			"message": "Connected to chat", "user_id": 1, "resume_token": "tok", "resumed": true, "replayed": 2, "last_session_seq": 5,
+		}), &chatpb.ServerFrame{Frame: &chatpb.ServerFrame_Welcome{Welcome: &chatpb.Welcome{
+			UserId: 1, ResumeToken: "tok", Resumed: true, Replayed: 2, LastSessionSeq: 5,
+		}}}},
+		{"ack", withSessionSeq(encode(ackPayload(stored, true)), 4), &chatpb.ServerFrame{SessionSeq: 4, Frame: &chatpb.ServerFrame_Ack{Ack: &chatpb.Ack{
+			Id: 10, ClientMsgId: "c1", Duplicate: true, Message: "Message sent", Stored: MessageToProto(stored),
+		}}}},
+		{"error", withSessionSeq(encode(map[string]string{"error": "Group not found."}), 6), &chatpb.ServerFrame{SessionSeq: 6, Frame: &chatpb.ServerFrame_Error{Error: &chatpb.Error{
+			Error: "Group not found.",
+		}}}},
+		{"message", withSessionSeq(encode(stored), 7), &chatpb.ServerFrame{SessionSeq: 7, Frame: &chatpb.ServerFrame_Message{Message: MessageToProto(stored)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeProtoFrame(tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			assertWireRoundTrip(t, got)
+		})
+	}
+
+	t.Run("event", func(t *testing.T) {
+		got, err := EncodeProtoFrame(withSessionSeq(encode(map[string]interface{}{"event": "pinned", "message_id": 10, "by": "alice"}), 8))
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := got.GetEvent()
+		data := event.GetData().AsMap()
+		if got.SessionSeq != 8 || event.GetEvent() != "pinned" || data["message_id"] != float64(10) || data["by"] != "alice" || data["event"] != nil {
+			t.Fatalf("got %v", got)
+		}
+		assertWireRoundTrip(t, got)
+	})
+
+	if got := MessageToProto(stored); got.CreatedAt.AsTime() != created || got.Blocks[0].Text != "section" {
+		t.Fatalf("got message %v", got)
+	}
+}
+
+func assertWireRoundTrip(t *testing.T, frame *chatpb.ServerFrame) {
+	t.Helper()
+	binary, err := proto.Marshal(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBinary := &chatpb.ServerFrame{}
+	if err := proto.Unmarshal(binary, fromBinary); err != nil || !proto.Equal(fromBinary, frame) {
+		t.Fatalf("binary round trip: got %v, %v", fromBinary, err)
+	}
+	text, err := protojson.Marshal(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON := &chatpb.ServerFrame{}
+	if err := protojson.Unmarshal(text, fromJSON); err != nil || !proto.Equal(fromJSON, frame) {
+		t.Fatalf("JSON round trip: got %v, %v", fromJSON, err)
+	}
+}
+
+func TestDecodeClientFrame(t *testing.T) {
+	scheduled := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		frame *chatpb.ClientFrame
+		check func(t *testing.T, got clientFrame)
+	}{
+		{"send", &chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Send{Send: &chatpb.SendMessage{
+			GroupId:       3,
+			Content:       "hi",
+			Format:        entity.MessageFormatMarkdown,
+			ClientMsgId:   "c2",
+			AttachmentIds: []uint64{4, 5},
+			ScheduledTime: timestamppb.New(scheduled),
+			Blocks:        []*chatpb.Block{{Type: entity.BlockSection, Text: "s"}},
+		}}}, func(t *testing.T, got clientFrame) {
+			if got.Interaction != nil || got.GroupID != 3 || got.Content != "hi" || got.Format != entity.MessageFormatMarkdown || got.ClientMsgID != "c2" {
+				t.Fatalf("got %+v", got)
+			}
+			if len(got.AttachmentIDs) != 2 || got.AttachmentIDs[1] != 5 || !got.ScheduledTime.Equal(scheduled) || got.Blocks[0].Text != "s" {
+				t.Fatalf("got %+v", got)
+			}
+		}},
+		{"interaction", &chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Interaction{Interaction: &chatpb.Interaction{
+			MessageId: 9, ActionId: "form", Values: map[string]string{"reason": "because"},
+		}}}, func(t *testing.T, got clientFrame) {
+			i := got.Interaction
+			if i == nil || i.MessageID != 9 || i.ActionID != "form" || i.Values["reason"] != "because" {
+				t.Fatalf("got %+v", got)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Through both wire encodings, as envelopeConn reads them
+			binary, _ := proto.Marshal(tt.frame)
+			text, _ := protojson.Marshal(tt.frame)
+			fromBinary, fromJSON := &chatpb.ClientFrame{}, &chatpb.ClientFrame{}
+			if err := proto.Unmarshal(binary, fromBinary); err != nil {
+				t.Fatal(err)
+			}
+			if err := protojson.Unmarshal(text, fromJSON); err != nil {
+				t.Fatal(err)
+			}
+			for _, frame := range []*chatpb.ClientFrame{fromBinary, fromJSON} {
+				var got clientFrame
+				ok, err := DecodeClientFrame(frame, &got)
+				if !ok || err != nil {
+					t.Fatalf("got %v, %v", ok, err)
+				}
+				tt.check(t, got)
+			}
+		})
+	}
+
+	var got clientFrame
+	if ok, err := DecodeClientFrame(&chatpb.ClientFrame{}, &got); ok || err != nil {
+		t.Fatalf("empty frame: got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bytes"
+	"chat_app/entity"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// WebhookMaxAttempts is how often a delivery is tried before it becomes
+	// a dead letter.
+	WebhookMaxAttempts = 8
+	// webhookBackoff is the wait after the first failed attempt; it doubles
+	// after every further failure, so all attempts span about an hour.
+	webhookBackoff = 30 * time.Second
+	// webhookTimeout bounds a single attempt.
+	webhookTimeout = 10 * time.Second
+	// webhookLease keeps a delivery whose attempt is in flight from being
+	// picked up again by RetryDue.
+	webhookLease = time.Minute
+	// webhookRetryBatch caps the retries started per scheduler tick.
+	webhookRetryBatch = 100
+)
+
+// WebhookService delivers events to outgoing webhooks and keeps the rate
+// limits of incoming ones.
+type WebhookService struct {
+	DB      *gorm.DB
+	Client  *http.Client
+	limitMu sync.Mutex
+	limits  map[uint]*rateWindow // By incoming webhook ID
+
+	// Dispatch runs for every message, so the webhooks are cached until
+	// InvalidateWebhooks is called after a change.
+	webhooksMu     sync.Mutex
+	webhooks       []entity.Webhook
+	webhooksLoaded bool
+}
+
+// ErrBlockedAddress is returned when a webhook or callback URL resolves to
+// an address inside the server's own network.
+var ErrBlockedAddress = errors.New("address is not publicly routable")
+
+// IsPublicIP reports whether ip may be the target of a webhook request.
+// Loopback, private, link-local and unspecified addresses are refused, so
+// webhook URLs cannot reach services next to the server.
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+// newWebhookClient returns a client that checks every address it connects
+// to, after DNS resolution and on every redirect, so a public hostname that
+// resolves to an internal address is refused as well.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("%s: %w", host, ErrBlockedAddress)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the proxy's address the only one checked
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	return &WebhookService{
+		DB:     db,
+		Client: newWebhookClient(),
+		limits: make(map[uint]*rateWindow),
+	}
+}
+
+// NewWebhookSecret returns a random key for signing a webhook's deliveries.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload computes the X-Webhook-Signature header value: a hex
+// HMAC-SHA256 of the X-Webhook-Timestamp value, a dot and the body. Receivers
+// recompute it with their secret and should reject stale timestamps.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch records a delivery of an event for every webhook subscribed to
+// it and attempts them in the background.
+func (s *WebhookService) Dispatch(event string, data interface{}) {
+	webhooks, err := s.subscribers(event)
+	if err != nil {
+		log.Printf("Error fetching webhooks for %s: %v", event, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	var payload []byte
+	for _, webhook := range webhooks {
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(map[string]interface{}{
+				"event":      event,
+				"created_at": now,
+				"data":       data,
+			}); err != nil {
+				log.Printf("Error encoding %s webhook payload: %v", event, err)
+				return
+			}
+		}
+
+		delivery := entity.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        entity.DeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := s.DB.Create(&delivery).Error; err != nil {
+			log.Printf("Error recording %s delivery to webhook %d: %v", event, webhook.ID, err)
+			continue
+		}
+		go s.attempt(delivery.ID)
+	}
+}
+
+// subscribers returns the webhooks subscribed to an event, loading them into
+// the cache first if needed.
+func (s *WebhookService) subscribers(event string) ([]entity.Webhook, error) {
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	if !s.webhooksLoaded {
+		var webhooks []entity.Webhook
+		if err := s.DB.Find(&webhooks).Error; err != nil {
+			return nil, err
+		}
+		s.webhooks = webhooks
+		s.webhooksLoaded = true
+	}
+
+	var subscribed []entity.Webhook
+	for _, webhook := range s.webhooks {
+		if webhook.Subscribes(event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	return subscribed, nil
+}
+
+// InvalidateWebhooks drops the cached webhooks; the next Dispatch reloads
+// them. Call it after creating, changing or deleting a webhook.
+func (s *WebhookService) InvalidateWebhooks() {
+	s.webhooksMu.Lock()
+	s.webhooks = nil
+	s.webhooksLoaded = false
+	s.webhooksMu.Unlock()
+}
+
+// RetryDue starts the attempts of deliveries whose backoff has elapsed. It
+// runs on every scheduler tick.
+func (s *WebhookService) RetryDue() {
+	var ids []uint
+	if err := s.DB.Model(&entity.WebhookDelivery{}).
+		Where("status = ? AND next_attempt_at <= ?", entity.DeliveryPending, time.Now().UTC()).
+		Order("next_attempt_at").
+		Limit(webhookRetryBatch).
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("Error fetching due webhook deliveries: %v", err)
+		return
+	}
+	for _, id := range ids {
+		go s.attempt(id)
+	}
+}
+
+// Redeliver queues a dead letter for a fresh round of attempts.
+func (s *WebhookService) Redeliver(delivery *entity.WebhookDelivery) error {
+	now := time.Now().UTC()
+	delivery.Status = entity.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	if err := s.DB.Save(delivery).Error; err != nil {
+		return err
+	}
+	go s.attempt(delivery.ID)
+	return nil
+}
+
+// attempt sends a pending delivery once and records the outcome. The
+// delivery is claimed first, so concurrent callers cannot send it twice.
+func (s *WebhookService) attempt(deliveryID uint) {
+	now := time.Now().UTC()
+	claim := s.DB.Model(&entity.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", deliveryID, entity.DeliveryPending, now).
+		Update("next_attempt_at", now.Add(webhookLease))
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return
+	}
+
+	var delivery entity.WebhookDelivery
+	if err := s.DB.First(&delivery, deliveryID).Error; err != nil {
+		log.Printf("Error loading webhook delivery %d: %v", deliveryID, err)
+		return
+	}
+	delivery.Attempts++
+
+	var webhook entity.Webhook
+	err := s.DB.First(&webhook, delivery.WebhookID).Error
+	if err == nil {
+		delivery.LastStatusCode, err = s.post(webhook, delivery)
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errors.New("webhook was deleted")
+		delivery.Attempts = WebhookMaxAttempts
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = entity.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+	case delivery.Attempts >= WebhookMaxAttempts:
+		log.Printf("Webhook delivery %d failed for good after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+		delivery.Status = entity.DeliveryDead
+		delivery.NextAttemptAt = nil
+		delivery.LastError = err.Error()
+	default:
+		next := time.Now().UTC().Add(webhookBackoff << (delivery.Attempts - 1))
+		log.Printf("Webhook delivery %d failed (attempt %d), retrying at %v: %v", delivery.ID, delivery.Attempts, next, err)
+		delivery.NextAttemptAt = &next
+		delivery.LastError = err.Error()
+	}
+	if err := s.DB.Save(&delivery).Error; err != nil {
+		log.Printf("Error updating webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// post sends a signed delivery and returns the receiver's status code. Any
+// non-2xx response counts as a failure.
+func (s *WebhookService) post(webhook entity.Webhook, delivery entity.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"chat_app/entity"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestWebhook starts a TLS receiver answering with the status in status
+// and registers a webhook pointing at it.
+func newTestWebhook(t *testing.T, s *WebhookService, status *atomic.Int32, check func(*http.Request, []byte)) entity.Webhook {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if check != nil {
+			check(r, body)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+	s.Client = server.Client()
+
+	webhook := entity.Webhook{URL: server.URL, Events: entity.WebhookEventMessageCreated, Secret: "test-secret"}
+	if err := s.DB.Create(&webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.InvalidateWebhooks()
+	return webhook
+}
+
+func TestWebhookSignature(t *testing.T) {
+	s := NewWebhookService(newTestDB(t))
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	signatureFormat := regexp.MustCompile(`^sha256=[0-9a-f]{64}$`)
+	received := make(chan struct{}, 1)
+	webhook := newTestWebhook(t, s, &status, func(r *http.Request, body []byte) {
+		signature := r.Header.Get("X-Webhook-Signature")
+		if !signatureFormat.MatchString(signature) {
+			t.Errorf("signature %q does not have the sha256=<hex> format", signature)
+		}
+		if want := SignWebhookPayload("test-secret", r.Header.Get("X-Webhook-Timestamp"), body); signature != want {
+			t.Errorf("got signature %q, want %q", signature, want)
+		}
+		if event := r.Header.Get("X-Webhook-Event"); event != entity.WebhookEventMessageCreated {
+			t.Errorf("got event %q", event)
+		}
+		received <- struct{}{}
+	})
+
+	now := time.Now().UTC()
+	delivery := entity.WebhookDelivery{WebhookID: webhook.ID, Event: entity.WebhookEventMessageCreated, Payload: `{"event":"message.created"}`, Status: entity.DeliveryPending, NextAttemptAt: &now}
+	s.DB.Create(&delivery)
+	s.attempt(delivery.ID)
+	select {
+	case <-received:
+	default:
+		t.Fatal("the receiver got no request")
+	}
+}
+
+func TestWebhookAttemptTransitions(t *testing.T) {
+	s := NewWebhookService(newTestDB(t))
+	var status atomic.Int32
+	webhook := newTestWebhook(t, s, &status, nil)
+
+	now := time.Now().UTC()
+	delivery := entity.WebhookDelivery{WebhookID: webhook.ID, Event: entity.WebhookEventMessageCreated, Payload: "{}", Status: entity.DeliveryPending, NextAttemptAt: &now}
+	if err := s.DB.Create(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	reload := func() entity.WebhookDelivery {
+		var d entity.WebhookDelivery
+		if err := s.DB.First(&d, delivery.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	makeDue := func() {
+		s.DB.Model(&entity.WebhookDelivery{}).Where("id = ?", delivery.ID).Update("next_attempt_at", time.Now().UTC().Add(-time.Second))
+	}
+
+	// A failure schedules a retry after the backoff
+	status.Store(http.StatusInternalServerError)
+	s.attempt(delivery.ID)
+	d := reload()
+	if d.Status != entity.DeliveryPending || d.Attempts != 1 || d.LastStatusCode != http.StatusInternalServerError || d.LastError == "" {
+		t.Fatalf("after a failure: %+v", d)
+	}
+	if wait := d.NextAttemptAt.Sub(time.Now()); wait < webhookBackoff-5*time.Second || wait > webhookBackoff {
+		t.Fatalf("retry in %v, want about %v", wait, webhookBackoff)
+	}
+
+	// An attempt that is not due yet does nothing
+	s.attempt(delivery.ID)
+	if d := reload(); d.Attempts != 1 {
+		t.Fatalf("an attempt ran before its backoff elapsed: %+v", d)
+	}
+
+	// The last failed attempt turns the delivery into a dead letter
+	s.DB.Model(&entity.WebhookDelivery{}).Where("id = ?", delivery.ID).Update("attempts", WebhookMaxAttempts-1)
+	makeDue()
+	s.attempt(delivery.ID)
+	d = reload()
+	if d.Status != entity.DeliveryDead || d.Attempts != WebhookMaxAttempts || d.NextAttemptAt != nil {
+		t.Fatalf("after the last attempt: %+v", d)
+	}
+
+	// A redelivered dead letter starts over and can succeed
+	status.Store(http.StatusNoContent)
+	d.NextAttemptAt = nil
+	if err := s.Redeliver(&d); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for d = reload(); d.Status != entity.DeliveryDelivered; d = reload() {
+		if time.Now().After(deadline) {
+			t.Fatalf("redelivery did not succeed: %+v", d)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.Attempts != 1 || d.DeliveredAt == nil || d.LastError != "" {
+		t.Fatalf("after a redelivery: %+v", d)
+	}
+}
+
+func TestWebhookDispatchUsesCache(t *testing.T) {
+	s := NewWebhookService(newTestDB(t))
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	webhook := newTestWebhook(t, s, &status, nil)
+
+	deliveries := func() int64 {
+		var count int64
+		s.DB.Model(&entity.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID).Count(&count)
+		return count
+	}
+	s.Dispatch(entity.WebhookEventUserBlocked, nil)
+	if n := deliveries(); n != 0 {
+		t.Fatalf("unsubscribed event recorded %d deliveries", n)
+	}
+	s.Dispatch(entity.WebhookEventMessageCreated, nil)
+	if n := deliveries(); n != 1 {
+		t.Fatalf("got %d deliveries, want 1", n)
+	}
+
+	// Deleting without invalidating keeps the cached subscription
+	s.DB.Delete(&webhook)
+	s.Dispatch(entity.WebhookEventMessageCreated, nil)
+	if n := deliveries(); n != 2 {
+		t.Fatalf("got %d deliveries, want the cached webhook to get 2", n)
+	}
+	s.InvalidateWebhooks()
+	s.Dispatch(entity.WebhookEventMessageCreated, nil)
+	if n := deliveries(); n != 2 {
+		t.Fatalf("got %d deliveries after invalidating, want 2", n)
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	s := NewWebhookService(newTestDB(t))
+	var received atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(true)
+	}))
+	t.Cleanup(server.Close)
+
+	// httptest listens on loopback, which a callback must never reach
+	webhook := entity.IncomingWebhook{Token: "token", CallbackURL: server.URL}
+	_, err := s.PostInteraction(webhook, entity.MessageInteraction{}, map[string]interface{}{})
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("got error %v, want ErrBlockedAddress", err)
+	}
+	if received.Load() {
+		t.Fatal("the request reached a loopback receiver")
+	}
+
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.1", "169.254.169.254", "::1", "fe80::1", "0.0.0.0"} {
+		if IsPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s counts as public", addr)
+		}
+	}
+	if !IsPublicIP(net.ParseIP("93.184.216.34")) {
+		t.Error("a public address is refused")
+	}
+}
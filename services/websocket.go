@@ -2,6 +2,9 @@ package services
 
 import (
 	"chat_app/entity"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
@@ -17,205 +20,758 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins for testing
 	},
+	Subprotocols: []string{SubprotocolProto, SubprotocolJSON},
+}
+
+// Conn is the connection of a client: a WebSocket, possibly speaking a
+// chat.v1 subprotocol, or a gRPC stream adapted by the grpcapi package.
+// Frames are JSON; other encodings convert them.
+type Conn interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	WriteMessage(messageType int, data []byte) error
+	Close() error
 }
 
 type Client struct {
-	Conn   *websocket.Conn
-	UserID uint
+	Conn    Conn
+	UserID  uint
+	Session *Session
+	// Frames are written by writeFrames from a buffered queue, so fan-out
+	// under ws.Mutex never waits on a slow connection.
+	send     chan sessionFrame // Closed once the client is detached
+	written  chan struct{}     // Closed when writeFrames is done
+	detached bool
 }
 
 type WebSocketService struct {
-	DB        *gorm.DB
-	Clients   map[*Client]bool
-	Mutex     sync.Mutex
-	Broadcast chan entity.Message
+	DB          *gorm.DB
+	Attachments *AttachmentService
+	Webhooks    *WebhookService
+	Messages    *MessageService
+	Clients     map[*Client]bool
+	Sessions    map[string]*Session // By resume token, including detached sessions
+	Mutex       sync.Mutex
+	Broadcast   chan entity.Message
+
+	reactionMu            sync.Mutex
+	pendingReactionCounts map[uint]bool // Channel messages with a reaction_counts send queued
 }
 
-func NewWebSocketService(db *gorm.DB) *WebSocketService {
+func NewWebSocketService(db *gorm.DB, attachmentService *AttachmentService, webhookService *WebhookService, messageService *MessageService) *WebSocketService {
 	ws := &WebSocketService{
-		DB:        db,
-		Clients:   make(map[*Client]bool),
-		Broadcast: make(chan entity.Message),
+		DB:          db,
+		Attachments: attachmentService,
+		Webhooks:    webhookService,
+		Messages:    messageService,
+		Clients:     make(map[*Client]bool),
+		Sessions:    make(map[string]*Session),
+		Broadcast:   make(chan entity.Message),
+
+		pendingReactionCounts: make(map[uint]bool),
 	}
 	go ws.handleMessages()
+	go ws.expireSessions()
 	return ws
 }
 
+// HandleConnections upgrades the request and serves the connection. Clients
+// pick the frame encoding through Sec-WebSocket-Protocol; see
+// SubprotocolJSON and SubprotocolProto. See Serve for resuming sessions with
+// the resume_token and last_seq query parameters.
 func (ws *WebSocketService) HandleConnections(w http.ResponseWriter, r *http.Request, userID uint) {
-	log.Printf("WebSocket request headers: %v", r.Header)
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade failed:", err)
 		return
 	}
 
-	client := &Client{Conn: conn, UserID: userID}
+	log.Printf("WebSocket connection for user %d uses subprotocol %q", userID, conn.Subprotocol())
+	query := r.URL.Query()
+	go ws.Serve(newEnvelopeConn(conn), userID, query.Get("resume_token"), query.Get("last_seq"))
+}
+
+// Serve attaches a connection to a session and handles its frames until it
+// closes. The greeting carries a resume_token; reconnecting with it and the
+// last session_seq received within ResumeGracePeriod replays the missed
+// frames before live traffic.
+func (ws *WebSocketService) Serve(conn Conn, userID uint, resumeToken, lastSeq string) {
+	client := &Client{
+		Conn:    conn,
+		UserID:  userID,
+		send:    make(chan sessionFrame, clientQueueSize),
+		written: make(chan struct{}),
+	}
+
+	// Attach under the lock and hand the replay to the writer, which sends
+	// it before any live frame queued from then on
 	ws.Mutex.Lock()
+	session, replay := ws.resumeSession(userID, resumeToken, lastSeq)
+	resumed := session != nil
+	if !resumed {
+		var err error
+		if session, err = newSession(userID); err != nil {
+			ws.Mutex.Unlock()
+			log.Printf("Error creating session for user %d: %v", userID, err)
+			conn.Close()
+			return
+		}
+		ws.evictDetachedSessions(userID)
+		ws.Sessions[session.Token] = session
+	}
+	if old := session.client; old != nil {
+		// The old connection is dead but its read has not failed yet
+		ws.detach(old)
+		go old.Conn.Close()
+	}
+	session.client = client
+	client.Session = session
 	ws.Clients[client] = true
-	ws.Mutex.Unlock()
 
-	client.Conn.WriteJSON(map[string]interface{}{
-		"message": "Connected to chat",
-		"user_id": userID,
+	welcome, _ := json.Marshal(map[string]interface{}{
+		"message":          "Connected to chat",
+		"user_id":          userID,
+		"resume_token":     session.Token,
+		"resumed":          resumed,
+		"replayed":         len(replay),
+		"last_session_seq": session.lastSeq,
 	})
+	first := append([]sessionFrame{{data: welcome}}, replay...)
+	ws.Mutex.Unlock()
+	go ws.writeFrames(client, first)
+	if resumed {
+		log.Printf("User %d resumed session, replayed %d frames", userID, len(replay))
+	}
 
-	go ws.handleClient(client)
+	ws.handleClient(client)
 }
 
 func (ws *WebSocketService) handleClient(client *Client) {
 	defer func() {
 		ws.Mutex.Lock()
 		delete(ws.Clients, client)
+		ws.detach(client)
 		ws.Mutex.Unlock()
 		client.Conn.Close()
+		// Transports must not be written to once Serve returns
+		<-client.written
 		log.Printf("Client disconnected: user_id=%d", client.UserID)
 	}()
 
 	for {
-		var msg entity.Message
-		err := client.Conn.ReadJSON(&msg)
+		var frame clientFrame
+		err := client.Conn.ReadJSON(&frame)
 		if err != nil {
 			log.Println("Read error:", err)
 			break
 		}
-		log.Printf("Deserialized message: %+v", msg)
 
-		msg.SenderID = client.UserID
-		log.Printf("Message after setting SenderID: %+v", msg)
+		var ack map[string]interface{}
+		if frame.Interaction != nil {
+			log.Printf("Deserialized interaction: %+v", *frame.Interaction)
+			ack, err = ws.HandleInteraction(client.UserID, *frame.Interaction)
+		} else {
+			log.Printf("Deserialized message: %+v", frame.Message)
+			ack, err = ws.SubmitMessage(client.UserID, frame.Message)
+		}
+		if err != nil {
+			ws.reply(client, map[string]string{
+				"error": err.Error(),
+			})
+		} else if ack != nil {
+			ws.reply(client, ack)
+		}
+	}
+}
+
+// clientFrame is a frame read from a client: a message, or an interaction
+// with an interactive message.
+type clientFrame struct {
+	entity.Message
+	Interaction *InteractionRequest `json:"interaction,omitempty"`
+}
 
-		if msg.ScheduledTime != nil {
-			// Validate ScheduledTime
-			if msg.ScheduledTime.Before(time.Now().UTC()) {
-				log.Printf("Scheduled time is in the past: %v", msg.ScheduledTime)
-				client.Conn.WriteJSON(map[string]string{
-					"error": "Scheduled time must be in the future",
-				})
-				continue
+// ErrScheduleFailed is returned by SubmitMessage when a valid scheduled
+// message could not be stored.
+var ErrScheduleFailed = errors.New("Failed to schedule message")
+
+// SubmitMessage validates a message a client sent on any transport. A
+// slash command is routed to its bot, a scheduled message is stored and a
+// resend of a stored message is found again; all return their ack. An immediate message is queued on the
+// Broadcast channel and returns a nil ack: handleMessages acknowledges it
+// on the sender's sessions once stored. Errors are meant for the client.
+func (ws *WebSocketService) SubmitMessage(senderID uint, msg entity.Message) (map[string]interface{}, error) {
+	msg.Model = gorm.Model{} // IDs and timestamps are assigned by the server
+	msg.SenderID = senderID
+	msg.Kind = entity.MessageKindText // Clients cannot send system messages
+	msg.ForwardedFromSenderID = 0     // Provenance is only set by the forward endpoint
+	msg.ForwardedFromGroupID = 0
+	msg.ForwardedFromMessageID = 0
+	msg.ExpiresAt = nil // Derived from the conversation's disappearing timer
+	msg.ConversationID = 0
+	msg.Seq = 0 // Assigned when the message is sent
+	log.Printf("Message after setting SenderID: %+v", msg)
+
+	if msg.ReceiverID == 0 && msg.GroupID == 0 {
+		return nil, errors.New("A message needs a receiver_id or group_id")
+	}
+
+	if msg.Format == "" {
+		msg.Format = entity.MessageFormatPlain
+	}
+	if msg.Format != entity.MessageFormatPlain && msg.Format != entity.MessageFormatMarkdown {
+		return nil, errors.New("Format must be plain or markdown")
+	}
+
+	// Interactions are routed to the sender, so only bots can handle them
+	if len(msg.Blocks) > 0 {
+		var sender entity.User
+		if err := ws.DB.Select("role").First(&sender, senderID).Error; err != nil || !sender.IsBot() {
+			return nil, errors.New("Only bots can send interactive messages")
+		}
+		if err := msg.Blocks.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(msg.ClientMsgID) > maxClientMsgIDLength {
+		return nil, fmt.Errorf("client_msg_id cannot exceed %d characters", maxClientMsgIDLength)
+	}
+	// Slash commands go to their bot instead of the conversation
+	if msg.ScheduledTime == nil {
+		if ack, handled, err := ws.routeCommand(msg); handled {
+			return ack, err
+		}
+	}
+
+	// A resend after a reconnect gets the stored message back instead of
+	// creating a second copy
+	if existing, ok := ws.findByClientMsgID(msg.SenderID, msg.ClientMsgID); ok {
+		log.Printf("Duplicate client_msg_id %q from user %d, acknowledging message %d", msg.ClientMsgID, msg.SenderID, existing.ID)
+		return ackPayload(*existing, true), nil
+	}
+
+	if msg.ScheduledTime == nil {
+		log.Printf("Sending message to Broadcast channel: %+v", msg)
+		ws.Broadcast <- msg
+		return nil, nil
+	}
+
+	// Validate ScheduledTime
+	if msg.ScheduledTime.Before(time.Now().UTC()) {
+		log.Printf("Scheduled time is in the past: %v", msg.ScheduledTime)
+		return nil, errors.New("Scheduled time must be in the future")
+	}
+	if err := ws.Attachments.Validate(msg.SenderID, msg.AttachmentIDs); err != nil {
+		return nil, err
+	}
+	log.Printf("Saving scheduled message to DB: %+v", msg)
+	err := ws.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		return ws.Attachments.Link(tx, msg.ID, msg.SenderID, msg.AttachmentIDs)
+	})
+	if errors.Is(err, ErrAttachmentInvalid) {
+		return nil, err
+	}
+	if err != nil {
+		// A concurrent resend may have won the race for the client_msg_id
+		if existing, ok := ws.findByClientMsgID(msg.SenderID, msg.ClientMsgID); ok {
+			return ackPayload(*existing, true), nil
+		}
+		log.Printf("Error saving scheduled message: %v", err)
+		return nil, ErrScheduleFailed
+	}
+	return ackPayload(msg, false), nil
+}
+
+// SendGroupEvent stores a system message describing a group event in the
+// group's history and pushes it to the connected members through the
+// Broadcast channel. The target user also receives it when they are no
+// longer a member, so a removed user's connection learns about it.
+//
+// Membership churn in announcement channels is only reported to the
+// affected user, so subscribers are not flooded with join and leave events.
+func (ws *WebSocketService) SendGroupEvent(groupID uint, event string, actorID, targetUserID uint, content string) {
+	msg := entity.Message{
+		GroupID:      groupID,
+		Content:      content,
+		Kind:         entity.MessageKindSystem,
+		SystemEvent:  event,
+		ActorID:      actorID,
+		TargetUserID: targetUserID,
+	}
+
+	if isMembershipEvent(event) {
+		webhookEvent := entity.WebhookEventMemberRemoved
+		if event == entity.SystemEventJoined {
+			webhookEvent = entity.WebhookEventMemberAdded
+		}
+		ws.Webhooks.Dispatch(webhookEvent, map[string]interface{}{
+			"group_id": groupID,
+			"user_id":  targetUserID,
+			"actor_id": actorID,
+			"reason":   event,
+		})
+
+		var group entity.Group
+		if err := ws.DB.Select("type").First(&group, groupID).Error; err == nil && group.Type == entity.GroupTypeChannel {
+			if targetUserID != 0 {
+				ws.SendToUsers([]uint{targetUserID}, msg)
 			}
-			log.Printf("Saving scheduled message to DB: %+v", msg)
-			if err := ws.DB.Create(&msg).Error; err != nil {
-				log.Printf("Error saving scheduled message: %v", err)
-				client.Conn.WriteJSON(map[string]string{
-					"error": "Failed to schedule message",
-				})
-				continue
+			return
+		}
+	}
+
+	ws.Broadcast <- msg
+}
+
+// SendDirectEvent stores a system message about a direct conversation and
+// delivers it to the peer. The actor's own clients update from the API
+// response, as with regular direct messages.
+func (ws *WebSocketService) SendDirectEvent(actorID, peerID uint, event string, content string) {
+	ws.Broadcast <- entity.Message{
+		SenderID:    actorID,
+		ReceiverID:  peerID,
+		Content:     content,
+		Kind:        entity.MessageKindSystem,
+		SystemEvent: event,
+		ActorID:     actorID,
+	}
+}
+
+func isMembershipEvent(event string) bool {
+	return event == entity.SystemEventJoined || event == entity.SystemEventLeft || event == entity.SystemEventRemoved
+}
+
+// SendAnnouncement broadcasts a server-wide system message to every
+// connected user and stores it in the message history.
+func (ws *WebSocketService) SendAnnouncement(adminID uint, content string) {
+	ws.Broadcast <- entity.Message{
+		Content:     content,
+		Kind:        entity.MessageKindSystem,
+		SystemEvent: entity.SystemEventAnnouncement,
+		ActorID:     adminID,
+	}
+}
+
+// DisconnectUser closes every connection of a user, e.g. when the account
+// is disabled, and drops their sessions so they cannot be resumed.
+// handleClient removes the clients once their reads fail.
+func (ws *WebSocketService) DisconnectUser(userID uint, reason string) int {
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	closed := 0
+	for client := range ws.Clients {
+		if client.UserID != userID {
+			continue
+		}
+		// writeFrames closes the connection after sending the reason
+		if data, err := json.Marshal(map[string]string{"error": reason}); err == nil {
+			ws.queueFrame(client, sessionFrame{data: data})
+		}
+		ws.detach(client)
+		closed++
+	}
+	for token, session := range ws.Sessions {
+		if session.UserID == userID {
+			delete(ws.Sessions, token)
+		}
+	}
+	return closed
+}
+
+// Stats returns the number of open connections and distinct connected users.
+func (ws *WebSocketService) Stats() (connections, users int) {
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	seen := make(map[uint]bool)
+	for client := range ws.Clients {
+		seen[client.UserID] = true
+	}
+	return len(ws.Clients), len(seen)
+}
+
+// SendToUsers writes a payload to every session of the given users,
+// buffering it for sessions that are waiting to be resumed. It is used for
+// notifications that are not stored as messages.
+func (ws *WebSocketService) SendToUsers(userIDs []uint, payload interface{}) {
+	targets := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		targets[id] = true
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding notification: %v", err)
+		return
+	}
+
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	for _, session := range ws.Sessions {
+		if targets[session.UserID] {
+			ws.sendFrame(session, data)
+		}
+	}
+}
+
+// sendError writes an error frame to one session of a user, preferring one
+// with an open connection.
+func (ws *WebSocketService) sendError(userID uint, text string) {
+	data, err := json.Marshal(map[string]string{
+		"error": text,
+	})
+	if err != nil {
+		return
+	}
+
+	ws.Mutex.Lock()
+	defer ws.Mutex.Unlock()
+	var target *Session
+	for _, session := range ws.Sessions {
+		if session.UserID != userID {
+			continue
+		}
+		if target == nil || (target.client == nil && session.client != nil) {
+			target = session
+		}
+	}
+	if target != nil {
+		ws.sendFrame(target, data)
+	}
+}
+
+// groupRecipients returns the set of users a group message is delivered to:
+// active members who have not blocked the sender, plus the target of a
+// system event even if they have left the group.
+func (ws *WebSocketService) groupRecipients(msg entity.Message) (map[uint]bool, error) {
+	var userIDs []uint
+	query := ws.DB.Model(&entity.GroupMember{}).Where("group_id = ? AND deleted_at IS NULL", msg.GroupID)
+	if msg.SenderID != 0 {
+		query = query.Where("user_id NOT IN (?)", ws.DB.Model(&entity.BlockedUser{}).Select("user_id").Where("blocked_id = ?", msg.SenderID))
+	}
+	if err := query.Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+
+	recipients := make(map[uint]bool, len(userIDs)+1)
+	for _, id := range userIDs {
+		recipients[id] = true
+	}
+	if msg.Kind == entity.MessageKindSystem && msg.TargetUserID != 0 {
+		recipients[msg.TargetUserID] = true
+	}
+	return recipients, nil
+}
+
+// maxClientMsgIDLength bounds client-chosen message IDs; UUIDs fit easily.
+const maxClientMsgIDLength = 64
+
+// findByClientMsgID returns the sender's stored message with the given
+// client message ID, if any.
+func (ws *WebSocketService) findByClientMsgID(senderID uint, clientMsgID string) (*entity.Message, bool) {
+	if clientMsgID == "" {
+		return nil, false
+	}
+	var msg entity.Message
+	if err := ws.DB.Where("sender_id = ? AND client_msg_id = ?", senderID, clientMsgID).First(&msg).Error; err != nil {
+		return nil, false
+	}
+	return &msg, true
+}
+
+// ackPayload acknowledges a stored message to its sender. Duplicate is set
+// when the frame was a resend of a message stored earlier.
+func ackPayload(msg entity.Message, duplicate bool) map[string]interface{} {
+	text := "Message sent"
+	if msg.ScheduledTime != nil && !msg.Sent {
+		text = "Message scheduled successfully"
+	}
+	return map[string]interface{}{
+		"event":         "ack",
+		"message":       text,
+		"id":            msg.ID,
+		"client_msg_id": msg.ClientMsgID,
+		"duplicate":     duplicate,
+		"stored":        msg,
+	}
+}
+
+// messageTTL returns the disappearing timer of a message's conversation in
+// seconds, or 0 if messages are kept.
+func (ws *WebSocketService) messageTTL(msg entity.Message) int {
+	if msg.GroupID != 0 {
+		var group entity.Group
+		if err := ws.DB.Select("message_ttl").First(&group, msg.GroupID).Error; err != nil {
+			return 0
+		}
+		return group.MessageTTL
+	}
+	low, high := msg.DirectPair()
+	var conversation entity.Conversation
+	if err := ws.DB.Where("group_id = 0 AND low_user_id = ? AND high_user_id = ?", low, high).First(&conversation).Error; err != nil {
+		return 0
+	}
+	return conversation.MessageTTL
+}
+
+// ErrPostCheckFailed is returned by CheckPostable when the checks could not
+// be run; other errors it returns are meant for the sender.
+var ErrPostCheckFailed = errors.New("Error checking whether the message can be posted")
+
+// CheckPostable reports why the sender cannot post a message to its group
+// right now: not a member, archived group, muted, a channel they do not
+// administer, @all or @here in a large group, or slow mode. handleMessages runs it before storing a message;
+// paths that do work before queueing one run it first.
+func (ws *WebSocketService) CheckPostable(msg entity.Message) error {
+	if msg.GroupID == 0 || msg.Kind == entity.MessageKindSystem {
+		return nil
+	}
+	var senderMembership entity.GroupMember
+	if err := ws.DB.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", msg.GroupID, msg.SenderID).First(&senderMembership).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error fetching membership of user %d in group %d: %v", msg.SenderID, msg.GroupID, err)
+			return ErrPostCheckFailed
+		}
+		log.Printf("Sender (user_id=%d) is not a member of group %d or is soft-deleted, skipping message", msg.SenderID, msg.GroupID)
+		return errors.New("You are not a member of this group or have been removed.")
+	}
+
+	var group entity.Group
+	if err := ws.DB.First(&group, msg.GroupID).Error; err != nil {
+		log.Printf("Error fetching group %d: %v", msg.GroupID, err)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostCheckFailed
+		}
+		return errors.New("Group not found.")
+	}
+	if group.ArchivedAt != nil {
+		log.Printf("Group %d is archived, skipping message from user %d", msg.GroupID, msg.SenderID)
+		return errors.New("This group is archived and no longer accepts messages.")
+	}
+
+	now := time.Now().UTC()
+	if senderMembership.IsMuted(now) {
+		log.Printf("User %d is muted in group %d until %v, skipping message", msg.SenderID, msg.GroupID, senderMembership.MutedUntil)
+		return fmt.Errorf("You are muted in this group until %s.", senderMembership.MutedUntil.Format(time.RFC3339))
+	}
+
+	if group.Type == entity.GroupTypeChannel && !senderMembership.IsAdmin() {
+		log.Printf("User %d cannot post in channel %d", msg.SenderID, msg.GroupID)
+		return errors.New("Only channel owners and admins can post here.")
+	}
+
+	if group.MemberCount > MaxGroupMentionMembers {
+		if _, all, here := ParseMentions(msg.Content); all || here {
+			return fmt.Errorf("@all and @here are only available in groups of up to %d members.", MaxGroupMentionMembers)
+		}
+	}
+
+	// Slow mode applies to regular members only
+	if group.SlowMode > 0 && !senderMembership.IsAdmin() {
+		var last entity.Message
+		err := ws.DB.Where("group_id = ? AND sender_id = ? AND kind = ? AND id <> ?", msg.GroupID, msg.SenderID, entity.MessageKindText, msg.ID).
+			Order("created_at DESC").First(&last).Error
+		if err == nil {
+			wait := last.CreatedAt.Add(time.Duration(group.SlowMode) * time.Second).Sub(now)
+			if wait > 0 {
+				log.Printf("Slow mode: user %d must wait %v in group %d", msg.SenderID, wait, msg.GroupID)
+				return fmt.Errorf("Slow mode is on: you can send another message in %d seconds.", int(wait.Seconds())+1)
 			}
-			client.Conn.WriteJSON(map[string]interface{}{
-				"message": "Message scheduled successfully",
-				"id":      msg.ID,
-			})
-		} else {
-			log.Printf("Sending message to Broadcast channel: %+v", msg)
-			ws.Broadcast <- msg
 		}
 	}
+	return nil
+}
+
+// failScheduled records why a due scheduled message was rejected and tells
+// the sender. The message stays unsent and visible to the sender only.
+func (ws *WebSocketService) failScheduled(msg entity.Message, reason string) {
+	result := ws.DB.Model(&entity.Message{}).Where("id = ? AND sent = ?", msg.ID, false).Update("send_error", reason)
+	if result.Error != nil {
+		log.Printf("Error marking scheduled message %d as failed: %v", msg.ID, result.Error)
+	} else if result.RowsAffected == 0 {
+		return
+	}
+	log.Printf("Scheduled message %d from user %d was rejected: %s", msg.ID, msg.SenderID, reason)
+	ws.SendToUsers([]uint{msg.SenderID}, map[string]interface{}{
+		"event":      "scheduled_message_failed",
+		"message_id": msg.ID,
+		"error":      reason,
+	})
 }
 
 func (ws *WebSocketService) handleMessages() {
 	for msg := range ws.Broadcast {
 		log.Printf("Processing message: %+v", msg)
 
-		// For group messages, check membership before saving to the database
-		if msg.GroupID != 0 {
-			var senderMembership entity.GroupMember
-			if err := ws.DB.Where("group_id = ? AND user_id = ? AND deleted_at IS NULL", msg.GroupID, msg.SenderID).First(&senderMembership).Error; err != nil {
-				log.Printf("Sender (user_id=%d) is not a member of group %d or is soft-deleted, skipping message", msg.SenderID, msg.GroupID)
-				ws.Mutex.Lock()
-				for client := range ws.Clients {
-					if client.UserID == msg.SenderID {
-						errorMsg := map[string]string{
-							"error": "You are not a member of this group or have been removed.",
-						}
-						if err := client.Conn.WriteJSON(errorMsg); err != nil {
-							log.Printf("Error sending error message to user %d: %v", client.UserID, err)
-						}
-						break
-					}
-				}
-				ws.Mutex.Unlock()
+		// Only the server may broadcast to every connected user
+		if msg.ReceiverID == 0 && msg.GroupID == 0 && msg.Kind != entity.MessageKindSystem {
+			log.Printf("Rejecting broadcast from user %d", msg.SenderID)
+			ws.sendError(msg.SenderID, "A message needs a receiver_id or group_id.")
+			continue
+		}
+
+		if err := ws.CheckPostable(msg); err != nil {
+			if msg.ID != 0 && !msg.Sent {
+				ws.failScheduled(msg, err.Error())
+			} else {
+				ws.sendError(msg.SenderID, err.Error())
+			}
+			continue
+		}
+
+		// A stored message that is not sent yet is a due scheduled message.
+		// Claim it, so it goes out once even if the scheduler picks it up
+		// again before it is saved below.
+		if msg.ID != 0 && !msg.Sent {
+			claim := ws.DB.Model(&entity.Message{}).Where("id = ? AND sent = ?", msg.ID, false).Update("sent", true)
+			if claim.Error != nil {
+				log.Printf("Error claiming scheduled message %d: %v", msg.ID, claim.Error)
+				continue
+			}
+			if claim.RowsAffected == 0 {
+				log.Printf("Scheduled message %d was already sent, skipping", msg.ID)
 				continue
 			}
 		}
 
+		// Messages in conversations with a disappearing timer expire relative
+		// to delivery, so scheduled messages get their full lifetime
+		if msg.Kind != entity.MessageKindSystem && msg.ExpiresAt == nil {
+			if ttl := ws.messageTTL(msg); ttl > 0 {
+				expiresAt := time.Now().UTC().Add(time.Duration(ttl) * time.Second)
+				msg.ExpiresAt = &expiresAt
+			}
+		}
+
 		// Save the message to the database (only if the sender is a member for group messages)
 		if msg.ID == 0 { // Only save if the message hasn't been saved yet (e.g., for immediate messages)
-			if err := ws.DB.Create(&msg).Error; err != nil {
+			if err := ws.Attachments.Validate(msg.SenderID, msg.AttachmentIDs); err != nil {
+				log.Printf("Rejecting attachments from user %d: %v", msg.SenderID, err)
+				ws.sendError(msg.SenderID, err.Error())
+				continue
+			}
+			if err := ws.storeMessage(&msg); err != nil {
+				if errors.Is(err, ErrAttachmentInvalid) {
+					log.Printf("Rejecting attachments from user %d: %v", msg.SenderID, err)
+					ws.sendError(msg.SenderID, err.Error())
+					continue
+				}
+				// Two resends can both pass the check in handleClient; the
+				// unique index lets only one through
+				if existing, ok := ws.findByClientMsgID(msg.SenderID, msg.ClientMsgID); ok {
+					log.Printf("Duplicate client_msg_id %q from user %d, acknowledging message %d", msg.ClientMsgID, msg.SenderID, existing.ID)
+					ws.SendToUsers([]uint{msg.SenderID}, ackPayload(*existing, true))
+					continue
+				}
 				log.Printf("Error saving message to database: %v", err)
 				continue
 			}
 			log.Printf("Message saved to database with ID: %d", msg.ID)
+			if len(msg.ForwardedAttachments) > 0 {
+				if err := ws.Attachments.CopyForForward(msg.ID, msg.ForwardedAttachments); err != nil {
+					log.Printf("Error copying forwarded attachments to message %d: %v", msg.ID, err)
+				}
+			}
+			if msg.ClientMsgID != "" {
+				ws.SendToUsers([]uint{msg.SenderID}, ackPayload(msg, false))
+			}
+		}
+		if msg.Seq == 0 && (msg.GroupID != 0 || msg.ReceiverID != 0) {
+			if err := ws.assignSeq(&msg); err != nil {
+				log.Printf("Error assigning a sequence number to message %d: %v", msg.ID, err)
+				continue
+			}
+		}
+		if msg.Kind != entity.MessageKindSystem {
+			attachments, err := ws.Attachments.ForMessage(msg.ID)
+			if err != nil {
+				log.Printf("Error loading attachments for message %d: %v", msg.ID, err)
+			}
+			msg.Attachments = attachments
+		}
+		if msg.GroupID != 0 && msg.Kind == entity.MessageKindText {
+			mentioned, err := ws.resolveMentions(msg)
+			if err != nil {
+				log.Printf("Error resolving mentions in message %d: %v", msg.ID, err)
+			}
+			msg.Mentions = mentioned
 		}
 
-		ws.Mutex.Lock()
-		for client := range ws.Clients {
-			log.Printf("Checking client: user_id=%d", client.UserID)
+		// Resolve group recipients once so fan-out does not hit the database
+		// per session; large channels rely on this.
+		var recipients map[uint]bool
+		if msg.GroupID != 0 {
+			var err error
+			if recipients, err = ws.groupRecipients(msg); err != nil {
+				log.Printf("Error fetching group members for group %d: %v", msg.GroupID, err)
+				continue
+			}
+		}
+		blockedByReceiver := false
+		if msg.ReceiverID != 0 {
+			var blocked entity.BlockedUser
+			if err := ws.DB.Where("user_id = ? AND blocked_id = ?", msg.ReceiverID, msg.SenderID).First(&blocked).Error; err == nil {
+				log.Printf("User %d has blocked user %d, skipping direct message", msg.ReceiverID, msg.SenderID)
+				ws.sendError(msg.SenderID, "You have been blocked by the recipient.")
+				blockedByReceiver = true
+			}
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("Error encoding message %d: %v", msg.ID, err)
+			continue
+		}
 
+		// Deliver to every session, connected or waiting to be resumed
+		ws.Mutex.Lock()
+		for _, session := range ws.Sessions {
 			// Direct message
-			if msg.ReceiverID != 0 && client.UserID == msg.ReceiverID {
-				var blocked entity.BlockedUser
-				if err := ws.DB.Where("user_id = ? AND blocked_id = ?", msg.ReceiverID, msg.SenderID).First(&blocked).Error; err == nil {
-					log.Printf("User %d has blocked user %d, skipping direct message", msg.ReceiverID, msg.SenderID)
-					for senderClient := range ws.Clients {
-						if senderClient.UserID == msg.SenderID {
-							errorMsg := map[string]string{
-								"error": "You have been blocked by the recipient.",
-							}
-							if err := senderClient.Conn.WriteJSON(errorMsg); err != nil {
-								log.Printf("Error sending error message to user %d: %v", senderClient.UserID, err)
-							}
-							break
-						}
-					}
-					continue
+			if msg.ReceiverID != 0 {
+				if session.UserID == msg.ReceiverID && !blockedByReceiver {
+					log.Printf("Sending direct message to user %d", session.UserID)
+					ws.sendFrame(session, data)
 				}
-				log.Printf("Sending direct message to user %d", client.UserID)
-				client.Conn.WriteJSON(msg)
 				continue
 			}
 
 			// Group message
 			if msg.GroupID != 0 {
-				var members []entity.GroupMember
-				if err := ws.DB.Where("group_id = ? AND deleted_at IS NULL", msg.GroupID).Find(&members).Error; err != nil {
-					log.Printf("Error fetching group members for group %d: %v", msg.GroupID, err)
-					continue
-				}
-				log.Printf("Group %d members (excluding soft-deleted): %v", msg.GroupID, members)
-
-				for _, member := range members {
-					if client.UserID == member.UserID {
-						var blocked entity.BlockedUser
-						if err := ws.DB.Where("user_id = ? AND blocked_id = ?", client.UserID, msg.SenderID).First(&blocked).Error; err == nil {
-							log.Printf("User %d has blocked user %d, skipping group message", client.UserID, msg.SenderID)
-							continue
-						}
-						log.Printf("Sending group message to user %d", client.UserID)
-						if err := client.Conn.WriteJSON(msg); err != nil {
-							log.Printf("Error sending message to user %d: %v", client.UserID, err)
-						}
-						break
-					}
+				if recipients[session.UserID] {
+					log.Printf("Sending group message to user %d", session.UserID)
+					ws.sendFrame(session, data)
 				}
 				continue
 			}
 
-			// Broadcast message
-			if msg.ReceiverID == 0 && msg.GroupID == 0 {
-				log.Printf("Sending broadcast message to user %d", client.UserID)
-				client.Conn.WriteJSON(msg)
-				continue
-			}
-
-			log.Printf("Message not sent to user %d: no matching condition (ReceiverID=%d, GroupID=%d)", client.UserID, msg.ReceiverID, msg.GroupID)
+			// Broadcast message (server-generated only, see the check above)
+			log.Printf("Sending broadcast message to user %d", session.UserID)
+			ws.sendFrame(session, data)
 		}
 		ws.Mutex.Unlock()
 
+		// Mentions get their own event so clients notify even for muted groups
+		if len(msg.Mentions) > 0 {
+			ws.SendToUsers(msg.Mentions, map[string]interface{}{
+				"event":      "mention",
+				"message_id": msg.ID,
+				"group_id":   msg.GroupID,
+				"sender_id":  msg.SenderID,
+				"seq":        msg.Seq,
+				"content":    msg.Content,
+			})
+		}
+
 		// Mark the message as sent
 		if !msg.Sent {
 			msg.Sent = true
 			if err := ws.DB.Save(&msg).Error; err != nil {
 				log.Printf("Error marking message as sent: %v", err)
 			}
+			if msg.Kind == entity.MessageKindText {
+				ws.Webhooks.Dispatch(entity.WebhookEventMessageCreated, msg)
+			}
 		}
 	}
 }
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// newTestS3Store runs an in-memory S3 server in place of MinIO and connects a
+// store to it, which creates the bucket.
+func newTestS3Store(t *testing.T) *S3Store {
+	t.Helper()
+	server := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(server.Close)
+	store, err := NewS3Store(strings.TrimPrefix(server.URL, "http://"), "access", "secret", "attachments", false)
+	if err != nil {
+		t.Fatalf("connecting to the S3 stand-in: %v", err)
+	}
+	return store
+}
+
+func TestS3Store(t *testing.T) {
+	store := newTestS3Store(t)
+	ctx := context.Background()
+	data := []byte("hello attachment")
+
+	if err := store.Put(ctx, "blobs/a", bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, err := store.Get(ctx, "blobs/a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read %q, %v; want %q", got, err, data)
+	}
+
+	if err := store.Delete(ctx, "blobs/a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "blobs/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if _, err := store.Get(ctx, "blobs/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key: got %v, want ErrNotFound", err)
+	}
+
+	// Connecting again finds the existing bucket
+	if _, err := NewS3Store(strings.TrimPrefix(store.Client.EndpointURL().String(), "http://"), "access", "secret", "attachments", false); err != nil {
+		t.Fatalf("reconnecting: %v", err)
+	}
+}
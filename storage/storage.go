@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"chat_app/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned by Get when no blob exists under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores attachment contents under opaque keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStore builds the store selected by STORAGE_DRIVER.
+func NewBlobStore(cfg *config.Config) (BlobStore, error) {
+	switch cfg.StorageDriver {
+	case "local":
+		return NewLocalStore(cfg.StoragePath)
+	case "s3":
+		return NewS3Store(cfg.S3Endpoint, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Bucket, cfg.S3UseSSL)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}